@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// pathWriters maps each -format value to the function
+// writing a path in that format.
+var pathWriters = map[string]func(w io.Writer, path []*wiki.Page) error{
+	"text":         writeText,
+	"json":         writeJSON,
+	"json-summary": writeJSONSummary,
+	"dot":          writeDOT,
+	"csv":          writeCSV,
+	"ndjson":       writeNDJSON,
+	"mermaid":      writeMermaid,
+}
+
+// formatNames returns the accepted -format values.
+func formatNames() string {
+	names := make([]string, 0, len(pathWriters))
+	for name := range pathWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// writeText writes each page in path next to its offset
+// from the start page.
+func writeText(w io.Writer, path []*wiki.Page) error {
+	if _, err := fmt.Fprintf(w, "=== Link path of length %d ===\n", len(path)); err != nil {
+		return err
+	}
+	for i, page := range path {
+		line := fmt.Sprintf("Article %d, %s", i, urlName(page.Url))
+		if len(page.Redirects) > 0 {
+			line += fmt.Sprintf(" (→ %s)", urlName(page.Canonical()))
+		}
+		if page.LinkText != "" {
+			line += fmt.Sprintf(" (via %q)", page.LinkText)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonPage is the JSON representation of a page in a path.
+type jsonPage struct {
+	Index    int    `json:"index"`
+	Title    string `json:"title"`
+	Url      string `json:"url"`
+	LinkText string `json:"link_text,omitempty"`
+
+	// Urls the page was redirected to in turn
+	Redirects []string `json:"redirects,omitempty"`
+}
+
+// newJSONPage returns the JSON representation of page at index.
+func newJSONPage(index int, page *wiki.Page) jsonPage {
+	jp := jsonPage{Index: index, Title: page.Title, Url: page.Url.String(), LinkText: page.LinkText}
+	for _, ur := range page.Redirects {
+		jp.Redirects = append(jp.Redirects, ur.String())
+	}
+	return jp
+}
+
+// jsonPages returns the JSON representation of path.
+func jsonPages(path []*wiki.Page) []jsonPage {
+	pages := make([]jsonPage, len(path))
+	for i, page := range path {
+		pages[i] = newJSONPage(i, page)
+	}
+	return pages
+}
+
+// writeJSON writes path as a JSON array of pages.
+func writeJSON(w io.Writer, path []*wiki.Page) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonPages(path))
+}
+
+// jsonSummary is the JSON representation of the path of a crawl
+// along with its length and how many articles were visited.
+type jsonSummary struct {
+	Path       []jsonPage `json:"path"`
+	PathLength int        `json:"path_length"`
+	Visited    int64      `json:"visited,omitempty"`
+}
+
+// writeJSONSummary writes path as a JSON object of its pages and length.
+func writeJSONSummary(w io.Writer, path []*wiki.Page) error {
+	return writeJSONSummaryVisited(w, path, 0)
+}
+
+// writeJSONSummaryVisited writes path as writeJSONSummary does, along
+// with how many distinct articles its crawl visited, if known.
+func writeJSONSummaryVisited(w io.Writer, path []*wiki.Page, visited int64) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonSummary{Path: jsonPages(path), PathLength: len(path), Visited: visited})
+}
+
+// ndjsonHop is the NDJSON representation of a step of a crawl.
+type ndjsonHop struct {
+	Hop        int    `json:"hop"`
+	Kind       string `json:"kind"`
+	Title      string `json:"title"`
+	Url        string `json:"url"`
+	LinkText   string `json:"link_text,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ndjsonStop is the NDJSON representation of how a crawl ended,
+// the last line written for it.
+type ndjsonStop struct {
+	Reason     string `json:"reason"`
+	Hops       int    `json:"hops"`
+	PathLength int    `json:"path_length"`
+	Visited    int64  `json:"visited,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// writeLine writes v as a line of JSON with a single write, so that
+// a consumer reading w as it is written never sees part of a line.
+func writeLine(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// writeNDJSONEvent writes e as a line of JSON.
+func writeNDJSONEvent(w io.Writer, e wiki.Event) error {
+	return writeLine(w, ndjsonHop{
+		Hop:        e.Hop,
+		Kind:       e.Kind,
+		Title:      e.Page.Title,
+		Url:        e.Page.Url.String(),
+		LinkText:   e.Page.LinkText,
+		DurationMs: e.Page.Elapsed.Milliseconds(),
+	})
+}
+
+// writeNDJSON writes each page in path as a line of JSON, as
+// they would have been written as the crawl reached them.
+func writeNDJSON(w io.Writer, path []*wiki.Page) error {
+	for i, page := range path {
+		if err := writeNDJSONEvent(w, wiki.Event{Hop: i, Page: page, Kind: wiki.EventVisited}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNDJSONStop writes why the crawl which followed path
+// having visited that many distinct articles ended as a line
+// of JSON.
+func writeNDJSONStop(w io.Writer, path []*wiki.Page, visited int64, reason wiki.StopReason, err error) error {
+	stop := ndjsonStop{Reason: reason.String(), Hops: len(path) - 1, PathLength: len(path), Visited: visited}
+	if err != nil {
+		stop.Error = err.Error()
+	}
+	return writeLine(w, stop)
+}
+
+// writeCSV writes path as CSV with a header row
+// followed by a row for each page.
+func writeCSV(w io.Writer, path []*wiki.Page) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"index", "title", "url"})
+	for i, page := range path {
+		cw.Write([]string{strconv.Itoa(i), page.Title, page.Url.String()})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// dotQuoter escapes a string for use within a quoted DOT ID.
+var dotQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeDOT writes path as a GraphViz digraph, with a node for each
+// article and an edge labeled with the hop offset for each link.
+func writeDOT(w io.Writer, path []*wiki.Page) error {
+	if _, err := fmt.Fprintln(w, "digraph path {"); err != nil {
+		return err
+	}
+	for i, page := range path {
+		if _, err := fmt.Fprintf(w, "\t\"%s\";\n", dotQuoter.Replace(pageTitle(page))); err != nil {
+			return err
+		}
+		if i == 0 {
+			continue
+		}
+		from, to := dotQuoter.Replace(pageTitle(path[i-1])), dotQuoter.Replace(pageTitle(page))
+		if _, err := fmt.Fprintf(w, "\t\"%s\" -> \"%s\" [label=\"%d\"];\n", from, to, i); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// writeChains writes each chain of first links on a line of its own,
+// naming each article along it in turn.
+func writeChains(w io.Writer, chains [][]*wiki.Page) error {
+	for _, chain := range chains {
+		titles := make([]string, len(chain))
+		for i, page := range chain {
+			titles[i] = pageTitle(page)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(titles, " -> ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mermaidID returns a Mermaid node id for title, its ASCII letters
+// and digits with anything else replaced by underscores. It is
+// prefixed so that it never begins with a digit or is a keyword
+// such as "end".
+func mermaidID(title string) string {
+	id := []byte(title)
+	for i, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			id[i] = '_'
+		}
+	}
+	return "a_" + string(id)
+}
+
+// mermaidQuoter escapes a string for use within a quoted Mermaid label.
+var mermaidQuoter = strings.NewReplacer(`"`, "#quot;")
+
+// writeMermaid writes path as a Mermaid flowchart, with a node labeled
+// with the title of each article and an arrow for each link. An
+// article reached twice, as by a cycle, is the same node.
+func writeMermaid(w io.Writer, path []*wiki.Page) error {
+	if _, err := fmt.Fprintln(w, "graph TD"); err != nil {
+		return err
+	}
+	// Ids of the articles so far, by key, and the keys by id,
+	// so that articles whose titles have the same id differ
+	ids := make(map[string]string)
+	keys := make(map[string]string)
+	var prev string
+	for _, page := range path {
+		key := wiki.VisitKey(page.Canonical())
+		id, ok := ids[key]
+		if !ok {
+			id = mermaidID(pageTitle(page))
+			for n := 2; keys[id] != ""; n++ {
+				id = fmt.Sprintf("%s_%d", mermaidID(pageTitle(page)), n)
+			}
+			ids[key], keys[id] = id, key
+			if _, err := fmt.Fprintf(w, "    %s[\"%s\"]\n", id, mermaidQuoter.Replace(pageTitle(page))); err != nil {
+				return err
+			}
+		}
+		if prev != "" {
+			if _, err := fmt.Fprintf(w, "    %s --> %s\n", prev, id); err != nil {
+				return err
+			}
+		}
+		prev = id
+	}
+	return nil
+}
+
+// pageTitle returns the title of page, falling back to
+// its url with the prefix stripped if it has none, followed
+// by the article it was redirected to if it was.
+func pageTitle(page *wiki.Page) string {
+	title := page.Title
+	if title == "" {
+		title = urlName(page.Url)
+	}
+	if len(page.Redirects) > 0 {
+		title += fmt.Sprintf(" (→ %s)", urlName(page.Canonical()))
+	}
+	return title
+}
+
+// urlName returns how the article at ur is named in output, its url
+// less prefix, or with -pretty-titles its decoded title.
+func urlName(ur *url.URL) string {
+	if *prettyTitles {
+		return articleTitle(ur)
+	}
+	return strings.TrimPrefix(ur.String(), prefix)
+}
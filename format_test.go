@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// testPath returns a path through the articles with titles.
+func testPath(titles ...string) []*wiki.Page {
+	var path []*wiki.Page
+	for _, title := range titles {
+		ur := &url.URL{Scheme: "https", Host: "en.wikipedia.org", Path: "/wiki/" + title}
+		path = append(path, &wiki.Page{Title: title, Url: ur})
+	}
+	return path
+}
+
+// TestWriteJSON checks that -format json writes the path as an
+// array of its pages, and -format json-summary as an object with
+// the path length and articles visited along with the path.
+func TestWriteJSON(t *testing.T) {
+	path := testPath("Vehicle", "Machine", "Power")
+	var b strings.Builder
+	if err := writeJSON(&b, path); err != nil {
+		t.Fatal(err)
+	}
+	var pages []jsonPage
+	if err := json.Unmarshal([]byte(b.String()), &pages); err != nil {
+		t.Fatalf("cannot decode %s: %v", b.String(), err)
+	}
+	if len(pages) != 3 || pages[2].Title != "Power" {
+		t.Errorf("wrote %v, want 3 pages ending in Power", pages)
+	}
+
+	b.Reset()
+	if err := writeJSONSummaryVisited(&b, path, 5); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonSummary
+	if err := json.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatalf("cannot decode %s: %v", b.String(), err)
+	}
+	if got.PathLength != 3 || got.Visited != 5 || len(got.Path) != 3 {
+		t.Errorf("wrote path length %d, visited %d and %d pages, want 3, 5 and 3", got.PathLength, got.Visited, len(got.Path))
+	}
+	if got.Path[2].Title != "Power" {
+		t.Errorf("last page is %s, want Power", got.Path[2].Title)
+	}
+}
+
+// TestWriteMermaid checks the flowcharts of paths, including
+// titles with the same node id and titles with quotes.
+func TestWriteMermaid(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		path []*wiki.Page
+		want string
+	}{{
+		name: "three hops",
+		path: testPath("Vehicle", "Machine", "Power", "Physics"),
+		want: `graph TD
+    a_Vehicle["Vehicle"]
+    a_Machine["Machine"]
+    a_Vehicle --> a_Machine
+    a_Power["Power"]
+    a_Machine --> a_Power
+    a_Physics["Physics"]
+    a_Power --> a_Physics
+`,
+	}, {
+		name: "same id",
+		path: testPath("C++", "C--", "C++"),
+		want: `graph TD
+    a_C__["C++"]
+    a_C___2["C--"]
+    a_C__ --> a_C___2
+    a_C___2 --> a_C__
+`,
+	}, {
+		name: "quotes",
+		path: testPath(`"Weird_Al"_Yankovic`, "Parody"),
+		want: `graph TD
+    a__Weird_Al__Yankovic["#quot;Weird_Al#quot;_Yankovic"]
+    a_Parody["Parody"]
+    a__Weird_Al__Yankovic --> a_Parody
+`,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeMermaid(&b, tt.path); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,245 +1,1058 @@
-
-//
-// wikicrawl [target regexp] [start article]
+// wikicrawl [flags] [target regexp] [start article]
 //
 // Takes a regexp expression matching a target article name
-// and a start article name, e.g. "wikicrawl Car Vehicle"
+// and a start article name, e.g. "wikicrawl -target Car -start Vehicle"
 // will accept any url with "Car" in the name as a target,
-// and begins at http://en.wikipedia.org/wiki/Vehicle
+// and begins at https://en.wikipedia.org/wiki/Vehicle
+//
+// For backwards compatibility the target and start may also be
+// given positionally, e.g. "wikicrawl Car Vehicle".
+// Failing both, they are read as lines piped to stdin, e.g.
+// "echo -e 'Car\nVehicle' | wikicrawl".
+//
+// The -lang flag selects which language's Wikipedia is crawled,
+// e.g. "wikicrawl -lang=de Philosophie Auto" begins at
+// https://de.wikipedia.org/wiki/Auto
+//
+// The start article may also be given as a full url, e.g.
+// https://de.wikipedia.org/wiki/Auto, whose language is then used.
 //
 // Starting at the start article, the program follows the first
 // link in the article's text that links directly to another
 // article until the current article matches the target regexp.
 //
 // If the traversal is taking too long, sending SIGINT
-// (pressing ^C usually) will print the trip so far. Each
-// url next to its offset from the original page.
+// (pressing ^C usually) or SIGTERM will print the trip so far. Each
+// url next to its offset from the original page. Sending a
+// second SIGINT soon after the first exits immediately. The
+// -timeout flag, or -deadline, bounds the crawl in the same way,
+// e.g. -timeout=1m, stopping it with the reason "deadline exceeded".
 //
 // This tool was created in part because during school there
 // was once a saying that if one followed the first link on
 // a Wikipedia page and repeated this process long enough,
 // one would eventually get to a certian prominent historical
 // figure's Wikipedia page. Now, you can test how many links
-// it takes to do it, and get a readout of the trip.
+// it takes to do it, and get a readout of the trip. With
+// -samples=N the claim can be tested from N random articles,
+// e.g. "wikicrawl -samples=100 ^Philosophy$".
+//
+// With -bidirectional the target is an article rather than a
+// regexp, and the shortest path to it is found by searching
+// forward from the start and backward from the target at once,
+// e.g. "wikicrawl -bidirectional -start Vehicle Philosophy".
+//
+// With -reverse the target is an article too, and the articles
+// whose first links lead to it are listed, e.g.
+// "wikicrawl -reverse -max-hops=2 Philosophy".
+//
+// With -format=ndjson each step is printed as a line of JSON as
+// the crawl makes it, followed by a line giving why it stopped,
+// e.g. "wikicrawl -format=ndjson Philosophy Vehicle | jq .title".
+// -format=json prints the path as an array of its articles, and
+// -format=json-summary as an object holding that array along with
+// the path's length and how many distinct articles were visited.
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"golang.org/x/net/html"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"strings"
+	"path/filepath"
 	"regexp"
-	"container/list"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
+)
+
+// Wikipedia prefix string prepended to the start article
+// and stripped from url output. It is set from the -lang flag.
+var prefix string
+
+// prefixFormat is formatted with a language code to form prefix.
+const prefixFormat = "https://%s.wikipedia.org/wiki/"
+
+// Command line flags
+var (
+	startFlag       = flag.String("start", "", "name of the article to start crawling from")
+	langFlag        = flag.String("lang", "en", "language code of the Wikipedia to crawl")
+	timeout         = flag.Duration("timeout", 0, "stop the crawl after this long, 0 for no limit")
+	userAgent       = flag.String("user-agent", wiki.UserAgent, "User-Agent header sent with each request")
+	httpTimeout     = flag.Duration("http-timeout", wiki.DefaultTimeout, "timeout for each request")
+	maxRetries      = flag.Int("max-retries", wiki.MaxRetries, "times to retry a request after a transient failure")
+	maxRedirects    = flag.Int("max-redirects", wiki.MaxRedirects, "most redirects to follow for a request before skipping its link")
+	retryBackoff    = flag.Duration("retry-backoff", wiki.RetryBackoff, "delay before the first retry, doubled for each further retry")
+	delay           = flag.Duration("delay", 200*time.Millisecond, "minimum delay between requests, ignored if -rps is set")
+	rps             = flag.Float64("rps", 0, "requests per second allowed, overriding -delay")
+	burst           = flag.Int("burst", 1, "requests allowed in a burst above -rps or -delay")
+	ignoreCase      = flag.Bool("i", false, "match the target case-insensitively")
+	contentID       = flag.String("content-id", wiki.ContentID, "id of the div holding the article content")
+	outputClass     = flag.String("output-class", wiki.OutputClass, "class of the div holding the article prose, empty to use the content div")
+	matchTitle      = flag.Bool("match-title", false, "match the target against the decoded article title rather than the url")
+	maxHops         = flag.Int("max-hops", 0, "most links to follow before stopping, 0 for no limit")
+	randomWalk      = flag.Bool("random", false, "follow a random link from the first paragraph rather than the first link")
+	seed            = flag.Int64("seed", 0, "seed for -random, 0 to seed from the time")
+	logFormat       = flag.String("log-format", "text", "format of log records: text or json")
+	logFile         = flag.String("log-file", "", "write progress and log records to this file rather than stderr")
+	logLevel        = flag.String("log-level", "info", "least level of log records: debug, info, warn or error")
+	quiet           = flag.Bool("quiet", false, "only print the result, not each hop")
+	verbose         = flag.Bool("verbose", false, "also log each rejected link and why")
+	timings         = flag.Bool("timings", false, "print how long each hop took, and the total time taken")
+	bfs             = flag.Bool("bfs", false, "find the shortest path by following every link, not just the first")
+	prefetch        = flag.Bool("prefetch", false, "fetch each article as soon as the link to it is chosen, alongside reporting the last")
+	traceFlag       = flag.Bool("trace", false, "log how long each request spent on DNS, connecting, TLS and waiting, with totals at the end")
+	allowRevisit    = flag.Bool("allow-revisit", false, "follow links to articles already visited, stopping once the path leads back onto itself")
+	approxVisited   = flag.Bool("approx-visited", false, "with -bfs, remember visited articles in a bloom filter of bounded size, which may skip a link now and then; the queue of articles to expand is not bounded")
+	expectedVisited = flag.Int("expected-visited", 1000000, "articles the -approx-visited filter is sized for")
+	reverse         = flag.Bool("reverse", false, "take -target as an article and list the chains of first links leading to it, as far as -max-hops")
+	bidi            = flag.Bool("bidirectional", false, "take -target as an article and find the shortest path to it searching from both ends")
+	randomStart     = flag.Bool("random-start", false, "start from a random article, as does a start of Special:Random")
+	samples         = flag.Int("samples", 0, "crawl from this many random articles and print statistics rather than a path")
+	startsFile      = flag.String("starts", "", "crawl from each article listed one per line in this file and print a summary")
+	concurrency     = flag.Int("concurrency", 4, "most crawls to run at once with -samples or -starts")
+	outFile         = flag.String("out", "", "write the path to this file rather than stdout")
+	stateFile       = flag.String("state", "", "save progress to this file, resuming from it if it exists; not with -bfs, -bidirectional or -reverse")
+	fresh           = flag.Bool("fresh", false, "ignore any saved -state and start over")
+	useAPI          = flag.Bool("api", false, "fetch articles from the REST API rather than scraping the whole page")
+	cacheDir        = flag.String("cache", "", "cache fetched articles in this directory")
+	cacheTTL        = flag.Duration("cache-ttl", 0, "revalidate cached articles once this old, 0 to never")
+	graphFile       = flag.String("graph", "", "remember the first link of each article in this file, following it from there in later runs")
+	graphTTL        = flag.Duration("graph-ttl", 0, "forget first links remembered once this old, 0 to never")
+	noCache         = flag.Bool("no-cache", false, "ignore -cache, fetching every article")
+	maxBody         = flag.Int64("max-body", wiki.MaxBody, "most bytes to read from each article, 0 for no limit")
+	firstOnly       = flag.Bool("first-paragraph-only", false, "only look for a link in the first paragraph with text, not each paragraph until one has a link")
+	includeLists    = flag.Bool("include-lists", false, "fall back to the first link of a list item when no paragraph has one")
+	dryRun          = flag.Bool("dry-run", false, "only print the link which would be followed from the start, with -verbose the links rejected too")
+	tuiFlag         = flag.Bool("tui", false, "show the path live as the crawl goes, if stdout is a terminal")
+	serveAddr       = flag.String("serve", "", "serve crawls over HTTP on this address rather than crawling, e.g. :8080")
+	prettyTitles    = flag.Bool("pretty-titles", false, "print decoded article titles, e.g. \"Café\" rather than \"Caf%C3%A9\"")
+	proxyURL        = flag.String("proxy", "", "send requests through this http, https or socks5 proxy url, rather than that of HTTP_PROXY or HTTPS_PROXY")
+	linkIndex       = flag.Int("link-index", 1, "follow the accepted link of this index, counting from 1, rather than the first")
+	linkLast        = flag.Bool("link-index-last", false, "with -link-index, follow the last link of articles with fewer links rather than backtracking")
+	philosophy      = flag.Bool("philosophy", false, "play getting to Philosophy, stopping at its article, e.g. with -random-start")
+	metricsAddr     = flag.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9090")
+	replFlag        = flag.Bool("repl", false, "read \"start target\" lines and crawl for each in turn, sharing the client and cache")
+	format          = flag.String("format", "text", "format of the printed path: "+formatNames())
+)
+
+// targetFlags holds the -target patterns and avoid the -avoid
+// patterns, both of which may be given repeatedly.
+var (
+	targetFlags stringsFlag
+	avoid       regexpsFlag
 )
 
-// Wikipedia puts the main section of the article
-// within a div tag with the id "mw-content-text"
-var divId string = "mw-content-text"
+func init() {
+	flag.Var(&targetFlags, "target", "regexp matching the target article name, may be repeated to stop at any")
+	flag.Var(&avoid, "avoid", "regexp matching titles of articles never to follow, may be repeated")
+	flag.DurationVar(timeout, "deadline", 0, "same as -timeout")
+}
+
+// deadlineFrom is when the -timeout deadline began.
+var deadlineFrom time.Time
+
+// targetRegexes holds the compiled -target patterns.
+var targetRegexes []*regexp.Regexp
 
-// Wikipedia prefix string checked for in followed links
-// and stripped from url output.
-var prefix = "http://en.wikipedia.org/wiki/"
+// stringsFlag is a flag which may be given repeatedly.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
 
-// Page serves as a linked list of URLs.
-type Page struct {
-	// String it was redirected with
-	Title string
+// regexpsFlag is a flag which may be given repeatedly,
+// compiling each value as a regexp.
+type regexpsFlag []*regexp.Regexp
 
-	// URL of this page
-	Url   *url.URL
+func (f *regexpsFlag) String() string {
+	strs := make([]string, len(*f))
+	for i, re := range *f {
+		strs[i] = re.String()
+	}
+	return strings.Join(strs, ", ")
 }
 
-// FollowLink returns the first accepted link from a Page.
-// The body of the response from a GET request on the Page's Url
-// is parsed as html for a <p> tag within a <div> tag with an id
-// attribute matching divId.
-// An accepted html tag sequence may look like the following
-// psuedo regex expression:
-// <div id={divId}><div>+<p>+<a href={accepted url}>...
-func (page *Page) FollowLink(acceptFunc func(ur *url.URL) bool) (*Page, error) {
-	resp, err := http.Get(page.Url.String())
+func (f *regexpsFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
 	if err != nil {
-		return page, err
-	}
-
-	body := resp.Body
-	defer body.Close()
-
-	z := html.NewTokenizer(body)
-	inBody := false
-	inP := 0
-	depth := 0
-	for {
-		tt := z.Next()
-		switch tt {
-		case html.ErrorToken:
-			return page, z.Err()
-		case html.StartTagToken, html.EndTagToken:
-			tn, _ := z.TagName()
-			if string(tn) == "div" {
-				if tt == html.StartTagToken {
-					if inBody {
-						// Descend into an inner div
-						depth++
-					} else {
-						// This is a div tag
-						// Loop through attributes for an id
-						more := true
-						for more {
-							key, val, m := z.TagAttr()
-							more = m
-							if string(key) == "id" && string(val) == divId {
-								inBody = true
-							}
-						}
-					}
-				} else {
-					if depth == 0 {
-						inBody = false
-					}
-				}
-			} else if inBody && string(tn) == "p" {
-				if tt == html.StartTagToken {
-					inP++
-				} else {
-					inP--
-				}
-			} else if inP > 0 && tt == html.StartTagToken && string(tn) == "a" {
-				// This is an anchor tag
-				// This is an anchor tag in a div
-				// Check if it has an href attribute
-				more := true
-				pg := &Page{}
-				for more {
-					key, val, m := z.TagAttr()
-					more = m
-					if string(key) == "href" {
-						// Parse URL
-						ur, err := page.Url.Parse(string(val))
-						if err != nil {
-							// If this url is not parseable,
-							// skip to the second url
-							break
-						}
-						pg.Url = ur
-					} else if string(key) == "title" {
-						pg.Title = string(val)
-					}
-				}
-				if acceptFunc(pg.Url) {
-					return pg, nil
-				}
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+// notAvoided returns an AcceptFunc rejecting articles
+// whose titles match any of the -avoid patterns.
+func notAvoided() wiki.AcceptFunc {
+	return func(ur *url.URL) bool {
+		title := articleTitle(ur)
+		for _, re := range avoid {
+			if re.MatchString(title) {
+				return false
 			}
 		}
+		return true
+	}
+}
+
+// philosophyTarget is the target pattern of -philosophy.
+const philosophyTarget = "^Philosophy$"
+
+// forceExitWindow is how soon after a sigint or sigterm another
+// one exits immediately rather than stopping gracefully.
+const forceExitWindow = 3 * time.Second
+
+// logger receives progress and errors, apart from the path itself.
+var logger = slog.Default()
+
+// newLogHandler returns a handler writing records at or above
+// level to w in format, either text or json.
+func newLogHandler(w io.Writer, format, level string) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// fatal logs msg with args as an error and exits.
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// readLines returns the first n non-empty lines of r,
+// failing if it has fewer.
+func readLines(r io.Reader, n int) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for len(lines) < n && sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < n {
+		return nil, fmt.Errorf("expected %d lines, got %d", n, len(lines))
+	}
+	return lines, nil
+}
+
+// compileTarget compiles the target pattern,
+// case-insensitively with -i.
+func compileTarget(pattern string) (*regexp.Regexp, error) {
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// matchTarget returns an AcceptFunc accepting the articles any of
+// res match, by their title with -match-title or else their url.
+func matchTarget(res []*regexp.Regexp) wiki.AcceptFunc {
+	return func(ur *url.URL) bool {
+		return matchingTarget(res, ur) != nil
+	}
+}
+
+// matchingTarget returns the first of res matching the article
+// at ur as matchTarget does, or nil if none do.
+func matchingTarget(res []*regexp.Regexp, ur *url.URL) *regexp.Regexp {
+	str := strings.TrimPrefix(ur.String(), prefix)
+	if *matchTitle {
+		str = articleTitle(ur)
+	}
+	for _, re := range res {
+		if re.MatchString(str) {
+			return re
+		}
+	}
+	return nil
+}
+
+// logEvent logs a step of a crawl.
+func logEvent(e wiki.Event) {
+	switch e.Kind {
+	case wiki.EventVisited:
+		logger.Info("follow",
+			"hop", e.Hop,
+			"title", e.Page.Title,
+			"url", e.Page.Url.String(),
+			"duration", e.Page.Elapsed.Round(time.Millisecond))
+	case wiki.EventBacktracked:
+		logger.Info("backtrack", "hop", e.Hop, "title", e.Page.Title, "url", e.Page.Url.String())
+	case wiki.EventDeadEnd:
+		logger.Info("dead end", "hop", e.Hop, "title", e.Page.Title, "url", e.Page.Url.String())
+	}
+}
+
+// usage prints a usage message listing all flags.
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] [target regexp] [start article]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// startURL returns the url of the start article, given either
+// as an article name or as a full Wikipedia article url.
+// For a full url the prefix is set to match its language.
+func startURL(start string) (*url.URL, error) {
+	ur, full, err := parseStart(start)
+	if err == nil && full {
+		prefix = ur.Scheme + "://" + ur.Host + "/wiki/"
+	}
+	return ur, err
+}
+
+// queryStartURL returns the url of a start article given to the
+// repl or the server, as startURL does but leaving the prefix be,
+// as their crawls are on the prefix's Wikipedia alone.
+func queryStartURL(start string) (*url.URL, error) {
+	ur, full, err := parseStart(start)
+	if err == nil && full && !strings.HasPrefix(ur.String(), prefix) {
+		return nil, fmt.Errorf("start url %s is not on %s", start, prefix)
+	}
+	return ur, err
+}
+
+// parseStart returns the url of the start article and whether
+// it was given as a full url rather than an article name.
+func parseStart(start string) (*url.URL, bool, error) {
+	ur, err := url.Parse(start)
+	if err != nil || ur.Scheme == "" || ur.Host == "" {
+		ur, err = url.Parse(prefix + start)
+		return ur, false, err
+	}
+	if !strings.HasSuffix(ur.Host, ".wikipedia.org") || !strings.HasPrefix(ur.Path, "/wiki/") {
+		return nil, true, fmt.Errorf("start url %s is not a Wikipedia article", start)
+	}
+	// Wikipedia only serves https, see prefixFormat
+	ur.Scheme = "https"
+	return ur, true, nil
+}
+
+// articleTitle returns the title of the article at ur, with
+// percent-encoding decoded and underscores replaced by spaces.
+// The url with the prefix stripped is used if it cannot be decoded.
+func articleTitle(ur *url.URL) string {
+	str := strings.TrimPrefix(ur.String(), prefix)
+	if t, err := url.PathUnescape(str); err == nil {
+		str = t
+	}
+	return strings.ReplaceAll(str, "_", " ")
+}
+
+// cycleMembers returns the end of a path stopped by a cycle,
+// from the first visit of the article it led back to onwards.
+func cycleMembers(path []*wiki.Page) []*wiki.Page {
+	last := path[len(path)-1]
+	for i, page := range path[:len(path)-1] {
+		if wiki.VisitKey(page.Canonical()) == wiki.VisitKey(last.Canonical()) {
+			return path[i:]
+		}
+	}
+	return path
+}
+
+// loadState returns the crawl state saved in the file at name,
+// or nil if there is no such file.
+func loadState(name string) (*wiki.State, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state := &wiki.State{}
+	if err := json.Unmarshal(b, state); err != nil || len(state.Path) == 0 {
+		if err == nil {
+			err = errors.New("empty path")
+		}
+		return nil, fmt.Errorf("corrupt state file %s, use -fresh to start over: %w", name, err)
+	}
+	return state, nil
+}
+
+// saveState saves state to the file at name, replacing
+// it only once the state is completely written.
+func saveState(name string, state *wiki.State) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFile(name, b)
+}
+
+// loadGraph returns the link graph saved in the file at name,
+// or an empty one if there is no such file.
+func loadGraph(name string, ttl time.Duration) (*wiki.LinkGraph, error) {
+	g := wiki.NewLinkGraph(ttl)
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, g); err != nil {
+		return nil, fmt.Errorf("corrupt graph file %s: %w", name, err)
+	}
+	return g, nil
+}
+
+// saveGraph saves g, the graph of the crawler, to the -graph file
+// it was loaded from, if there is one.
+func saveGraph(g *wiki.LinkGraph) {
+	if g == nil {
+		return
+	}
+	b, err := json.Marshal(g)
+	if err == nil {
+		err = writeFile(*graphFile, b)
+	}
+	if err != nil {
+		logger.Warn("cannot save graph", "graph", *graphFile, "err", err)
+	}
+}
+
+// writeFile replaces the file at name with b, writing it
+// alongside first so that it is never left partly written.
+func writeFile(name string, b []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// createOutput creates the file at name for writing the path,
+// along with any missing parent directories.
+func createOutput(name string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
+
+// formatBytes describes n bytes in the largest unit of which it is
+// at least one.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// writeTraceTotals writes the total time requests spent in each
+// phase, if they were traced.
+func writeTraceTotals(w io.Writer) {
+	t := wiki.TraceTotals()
+	if t.Requests == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Traced %d requests, DNS %v, connect %v, TLS %v, first byte %v\n",
+		t.Requests,
+		t.DNS.Round(time.Millisecond),
+		t.Connect.Round(time.Millisecond),
+		t.TLS.Round(time.Millisecond),
+		t.FirstByte.Round(time.Millisecond))
+}
+
+// averageHop describes the average time taken by each hop of path.
+func averageHop(path []*wiki.Page) string {
+	if len(path) < 2 {
+		return "no hops"
 	}
+	var sum time.Duration
+	for _, page := range path[1:] {
+		sum += page.Elapsed
+	}
+	return fmt.Sprintf("average of %v per hop", (sum / time.Duration(len(path)-1)).Round(time.Millisecond))
+}
+
+// stopMessage describes why a crawl which followed path ended.
+func stopMessage(path []*wiki.Page, reason wiki.StopReason, err error) string {
+	switch reason {
+	case wiki.Matched:
+		last := path[len(path)-1]
+		re := matchingTarget(targetRegexes, last.Url)
+		if re == nil {
+			re = matchingTarget(targetRegexes, last.Canonical())
+		}
+		if re != nil {
+			return fmt.Sprintf("matched target %q after %d follows", re, len(path)-1)
+		}
+		return fmt.Sprintf("matched target after %d follows", len(path)-1)
+	case wiki.DeadEnd:
+		return "dead end, no valid links"
+	case wiki.Cycle:
+		members := cycleMembers(path)
+		titles := make([]string, len(members))
+		for i, page := range members {
+			titles[i] = pageTitle(page)
+		}
+		return fmt.Sprintf("cycle of %d articles, %s", len(members)-1, strings.Join(titles, " -> "))
+	case wiki.Interrupted:
+		return "interrupted"
+	case wiki.DeadlineExceeded:
+		return fmt.Sprintf("deadline exceeded after %v of %v", time.Since(deadlineFrom).Round(time.Millisecond), *timeout)
+	case wiki.Error:
+		return fmt.Sprintf("error, %v", err)
+	case wiki.LimitReached:
+		return fmt.Sprintf("reached the limit of %d hops", *maxHops)
+	}
+	return reason.String()
 }
 
 func main() {
-	haveVisited := make(map[url.URL]Page)
+	flag.Usage = usage
+	flag.Parse()
 
-	var targetRegex *regexp.Regexp
-	pageList := list.New()
+	// Getting to Philosophy stops at its article by title,
+	// the first link rules already being those of the game
+	if *philosophy {
+		if len(targetFlags) > 0 {
+			fmt.Fprintln(os.Stderr, "-philosophy and -target are mutually exclusive")
+			flag.Usage()
+			os.Exit(2)
+		}
+		targetFlags = append(targetFlags, philosophyTarget)
+		*matchTitle = true
+	}
 
-	if len(os.Args) == 3 {
-		var err error
-		targetRegex, err = regexp.Compile(os.Args[1])
+	// Leftover positional arguments fill in the target
+	// and start, in that order, if not given as flags.
+	args := flag.Args()
+	if len(targetFlags) == 0 && len(args) > 0 {
+		targetFlags = append(targetFlags, args[0])
+		args = args[1:]
+	}
+	if *startFlag == "" && len(args) > 0 {
+		*startFlag = args[0]
+		args = args[1:]
+	}
+	// Then lines piped to stdin, in the same order,
+	// e.g. echo -e "Philosophy\nVehicle" | wikicrawl
+	needTarget := len(targetFlags) == 0
+	needStart := *startFlag == "" && !*reverse && !*randomStart && *samples <= 0 && *startsFile == "" && *stateFile == ""
+	if *serveAddr == "" && !*replFlag && (needTarget || needStart) && len(args) == 0 && !isTerminal(os.Stdin) {
+		var names []string
+		if needTarget {
+			names = append(names, "target")
+		}
+		if needStart {
+			names = append(names, "start")
+		}
+		lines, err := readLines(os.Stdin, len(names))
 		if err != nil {
-			log.Fatal(err.Error())
+			fmt.Fprintf(os.Stderr, "cannot read %s from stdin: %v\n", strings.Join(names, " and "), err)
+			os.Exit(2)
+		}
+		if needTarget {
+			targetFlags = append(targetFlags, lines[0])
+			lines = lines[1:]
+		}
+		if needStart {
+			*startFlag = lines[0]
+		}
+	}
+	if (*serveAddr == "" && !*replFlag && (len(targetFlags) == 0 || (*startFlag == "" && !*reverse && !*randomStart && *samples <= 0 && *startsFile == "" && *stateFile == ""))) || len(args) > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be at least 1")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *approxVisited && *expectedVisited < 1 {
+		fmt.Fprintln(os.Stderr, "-expected-visited must be at least 1")
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Only the first-link crawl saves and resumes its state
+	if *stateFile != "" && (*bfs || *bidi || *reverse) {
+		fmt.Fprintln(os.Stderr, "-state cannot be used with -bfs, -bidirectional or -reverse")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *burst < 1 {
+		fmt.Fprintln(os.Stderr, "-burst must be at least 1")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *retryBackoff < 0 {
+		fmt.Fprintln(os.Stderr, "-retry-backoff must not be negative")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *linkIndex < 1 {
+		fmt.Fprintln(os.Stderr, "-link-index must be at least 1")
+		flag.Usage()
+		os.Exit(2)
+	}
+	writePath, ok := pathWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q, must be one of %s\n", *format, formatNames())
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Only -format json-summary has room for how many articles were visited
+	writeResult := func(w io.Writer, path []*wiki.Page, visited int64) error {
+		if *format == "json-summary" {
+			return writeJSONSummaryVisited(w, path, visited)
 		}
+		return writePath(w, path)
+	}
 
-		var ur *url.URL
-		ur, err = url.Parse(prefix+os.Args[2])
+	if *quiet && *verbose {
+		fmt.Fprintln(os.Stderr, "-quiet and -verbose are mutually exclusive")
+		flag.Usage()
+		os.Exit(2)
+	}
+	level := *logLevel
+	if *quiet {
+		level = "warn"
+	} else if *verbose {
+		level = "debug"
+	}
+	// Progress goes to stderr unless asked otherwise,
+	// keeping it apart from the path on stdout or -out
+	var progress io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := createOutput(*logFile)
 		if err != nil {
-			log.Fatal(err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		defer f.Close()
+		progress = f
+	}
+	handler, err := newLogHandler(progress, *logFormat, level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	logger = slog.New(handler)
+	wiki.Logger = logger
 
-		// Initial page to start crawler
-		pageList.PushBack(&Page{Title: os.Args[2], Url: ur})
+	prefix = fmt.Sprintf(prefixFormat, *langFlag)
+	wiki.UserAgent = *userAgent
+	wiki.Client.Timeout = *httpTimeout
+	if *proxyURL != "" {
+		if err := wiki.UseProxy(*proxyURL); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	wiki.MaxRetries = *maxRetries
+	wiki.MaxRedirects = *maxRedirects
+	wiki.Trace = *traceFlag
+	wiki.RetryBackoff = *retryBackoff
+	if *rps > 0 {
+		wiki.Limiter.SetLimit(rate.Limit(*rps))
 	} else {
-		fmt.Println("Needs url to start crawler")
-		return
+		wiki.Limiter.SetLimit(rate.Every(*delay))
 	}
+	wiki.Limiter.SetBurst(*burst)
+	wiki.MaxHops = *maxHops
+	wiki.ContentID = *contentID
+	wiki.MaxBody = *maxBody
+	if *metricsAddr != "" {
+		if err := wiki.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+			fatal("cannot register metrics", "err", err)
+		}
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				logger.Error("cannot serve metrics", "err", err)
+			}
+		}()
+	}
+	var graph *wiki.LinkGraph
+	if *graphFile != "" {
+		graph, err = loadGraph(*graphFile, *graphTTL)
+		if err != nil {
+			fatal("cannot load graph", "err", err)
+		}
+	}
+	if *cacheDir != "" && !*noCache {
+		wiki.Cache = &wiki.DiskCache{Dir: *cacheDir, TTL: *cacheTTL}
+	}
+	var walk *rand.Rand
+	if *randomWalk {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+			logger.Info("random walk", "seed", *seed)
+		}
+		walk = rand.New(rand.NewSource(*seed))
+	}
+	approx := 0
+	if *approxVisited {
+		approx = *expectedVisited
+	}
+	wiki.OutputClass = *outputClass
 
-	done := make(chan bool)
-	go func () {
-		for {
-			listItem := pageList.Back()
-			page := listItem.Value.(*Page)
-
-			fmt.Printf("Follow %d, link to %s\n", pageList.Len(), page.Title)
+	// Parse the starts before building the link rules,
+	// as a full url sets the prefix
+	var start *url.URL
+	if *startFlag != "" && *startFlag != "Special:Random" && !*randomStart {
+		start, err = startURL(*startFlag)
+		if err != nil {
+			fatal("cannot start crawl", "err", err)
+		}
+	}
+	var starts []*url.URL
+	if *startsFile != "" {
+		starts, err = readStarts(*startsFile)
+		if err != nil {
+			fatal("cannot read starts", "err", err)
+		}
+	}
 
-			haveVisited[*page.Url] = *page
+	var to *url.URL
+	if *bidi || *reverse {
+		if len(targetFlags) != 1 {
+			fatal("-bidirectional and -reverse need exactly one target article")
+		}
+		to, err = startURL(targetFlags[0])
+		if err != nil {
+			fatal("invalid target article", "err", err)
+		}
+	} else {
+		for _, pattern := range targetFlags {
+			re, err := compileTarget(pattern)
+			if err != nil {
+				fatal("invalid target pattern", "pattern", pattern, "err", err)
+			}
+			targetRegexes = append(targetRegexes, re)
+		}
+	}
 
-			// Match against user provided regex
-			if targetRegex.MatchString(strings.TrimPrefix(page.Url.String(), prefix)) {
-				fmt.Printf("Found match, took %d follows\n", pageList.Len())
-				break
+	// Stop the crawl on sigint, the path so far is still printed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The repl times each query's crawl out on its own
+	if *timeout > 0 && !*replFlag {
+		deadlineFrom = time.Now()
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, *timeout)
+		defer cancelTimeout()
+	}
+	// Stop gracefully on sigterm too, so supervisors stopping
+	// the process still get the path. A second signal soon
+	// after the first exits at once, in case printing hangs.
+	// The REPL stops only the crawl of its current query on
+	// sigint, the prompt then exiting on a sigint as usual.
+	sig := make(chan os.Signal, 2)
+	if *replFlag {
+		signal.Notify(sig, syscall.SIGTERM)
+	} else {
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	}
+	go func() {
+		var last time.Time
+		for range sig {
+			if !last.IsZero() && time.Since(last) < forceExitWindow {
+				os.Exit(130)
 			}
+			last = time.Now()
+			cancel()
+		}
+	}()
 
-			// Get next link
-			pg, err := page.FollowLink(func(ur *url.URL) bool {
-				// Don't Revisit pages
-				p := haveVisited[*ur]
-				if p.Url != nil {
-					return false
-				}
+	// Match against user provided regex
+	target := matchTarget(targetRegexes)
+	if to != nil {
+		target = func(ur *url.URL) bool {
+			return wiki.VisitKey(ur) == wiki.VisitKey(to)
+		}
+	}
+	follow := wiki.All(
+		wiki.WithReason("not on Wikipedia", wiki.OnWikipedia(prefix)),
+		wiki.WithReason("not an article", wiki.ArticleNamespaceOnly()),
+		wiki.WithReason("avoided", notAvoided()),
+	)
+	crawler := &wiki.Crawler{
+		Prefix:             prefix,
+		ContentID:          *contentID,
+		Client:             wiki.Client,
+		Target:             target,
+		Accept:             follow,
+		MaxHops:            *maxHops,
+		UseAPI:             *useAPI,
+		Rand:               walk,
+		FirstParagraphOnly: *firstOnly,
+		IncludeLists:       *includeLists,
+		LinkIndex:          *linkIndex,
+		LinkIndexLast:      *linkLast,
+		AllowRevisit:       *allowRevisit,
+		Prefetch:           *prefetch,
+		Graph:              graph,
+		ApproxVisited:      approx,
+	}
 
-				// Don't leave the world of Wikipedia
-				if !strings.HasPrefix(ur.String(), prefix) {
-					return false
+	// Log the progress of crawls as they go, or show it live
+	// on the terminal for a single crawl with -tui
+	var view *tui
+	if *tuiFlag && *format != "ndjson" && *serveAddr == "" && !*replFlag && *samples <= 0 && *startsFile == "" && isTerminal(os.Stdout) {
+		view = newTUI(os.Stdout)
+	}
+	events := make(chan wiki.Event)
+	crawler.Events = events
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		var tick <-chan time.Time
+		if view != nil {
+			t := time.NewTicker(200 * time.Millisecond)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					if view != nil {
+						view.clear()
+					}
+					return
+				}
+				if view != nil {
+					view.update(e)
+					view.draw()
+				} else {
+					logEvent(e)
 				}
+			case <-tick:
+				view.draw()
+			}
+		}
+	}()
 
-				// check after prefix url
-				str := strings.TrimPrefix(ur.String(), prefix)
+	if *serveAddr != "" {
+		if err := serve(*serveAddr, crawler); err != nil {
+			fatal("cannot serve", "err", err)
+		}
+		return
+	}
+	if *replFlag {
+		if err := repl(ctx, os.Stdin, os.Stdout, crawler, writeResult); err != nil {
+			fatal("cannot read query", "err", err)
+		}
+		saveGraph(crawler.Graph)
+		return
+	}
+	if *reverse {
+		chains, err := crawler.Predecessors(ctx, to)
+		close(events)
+		<-logged
+		if werr := writeChains(os.Stdout, chains); werr != nil {
+			fatal("cannot write chains", "err", werr)
+		}
+		saveGraph(crawler.Graph)
+		if err != nil && !errors.Is(err, wiki.ErrCanceled) {
+			fatal("cannot search backward", "err", err)
+		}
+		return
+	}
+	if *samples > 0 {
+		writeSampleStats(os.Stdout, runSamples(ctx, *samples, *concurrency, crawler))
+		writeTraceTotals(os.Stdout)
+		saveGraph(crawler.Graph)
+		return
+	}
+	if *startsFile != "" {
+		results := runStarts(ctx, starts, *concurrency, crawler)
+		saveGraph(crawler.Graph)
+		if err := writeStartsTable(os.Stdout, results); err != nil {
+			fatal("cannot write summary", "err", err)
+		}
+		return
+	}
 
-				// Cannot be a file, e.g. a resource page
-				// Cannot be a non top-level Wikipedia page
-				// Cannot be a sup page hash link
-				if strings.Contains(str, ":") || strings.Contains(str, "/") || strings.Contains(str, "#") {
-					return false
-				}
+	// Show the first link without crawling or saving any state
+	if *dryRun {
+		if *randomStart || *startFlag == "Special:Random" {
+			start, err = wiki.RandomArticle(ctx, prefix)
+		} else if start == nil {
+			err = errors.New("no start article")
+		}
+		if err != nil {
+			fatal("cannot start crawl", "err", err)
+		}
+		page := &wiki.Page{Title: articleTitle(start), Url: start}
+		next, err := crawler.FollowLink(ctx, page)
+		if err != nil {
+			fatal("cannot find a link to follow", "title", page.Title, "err", err)
+		}
+		fmt.Printf("%s would follow %s (via %q)\n", page.Title, next.Url, next.LinkText)
+		return
+	}
 
-				return true
-			})
+	// Open the output up front, so a bad path is
+	// found before crawling rather than after
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = createOutput(*outFile)
+		if err != nil {
+			fatal("cannot create output file", "err", err)
+		}
+	}
+
+	// Resume from a saved state if there is one
+	var state *wiki.State
+	if *stateFile != "" {
+		if !*fresh {
+			state, err = loadState(*stateFile)
 			if err != nil {
-				str := err.Error()
-				if len(str) >= 3 && str[len(str)-3:] == "EOF" {
-					// Could not find a link on this file,
-					// Go back up one page
-					e := listItem.Prev()
-					if e == nil {
-						log.Fatal("Cannot find links on provided page")
-					}
-					pageList.Remove(e)
-					page = e.Value.(*Page)
-					continue
-				}
-				log.Fatal(err)
+				fatal("cannot resume crawl", "err", err)
 			}
-			pageList.PushBack(pg)
 		}
-		done <- true
-	}()
+		crawler.Checkpoint = func(s *wiki.State) error {
+			return saveState(*stateFile, s)
+		}
+	}
 
-	sig := make(chan os.Signal)
-	signal.Notify(sig, os.Interrupt)
+	// Stream each step of the crawl as it is made with -format
+	// ndjson, rather than writing the path once it is found
+	stream := *format == "ndjson" && to == nil && !*bfs
+	var steps chan wiki.Event
+	streamed := make(chan struct{})
+	if stream {
+		steps = make(chan wiki.Event)
+		ctx = wiki.WithEvents(ctx, steps)
+		go func() {
+			defer close(streamed)
+			for e := range steps {
+				logEvent(e)
+				if err := writeNDJSONEvent(out, e); err != nil {
+					logger.Warn("cannot write step", "err", err)
+				}
+			}
+		}()
+	} else {
+		close(streamed)
+	}
 
-	// Wait for successful path or sigint
-	select {
-	case <-done:
-	case <-sig:
+	var path []*wiki.Page
+	var reason wiki.StopReason
+	began := time.Now()
+	if state != nil {
+		last := state.Path[len(state.Path)-1]
+		logger.Info("resuming crawl", "state", *stateFile, "title", last.Title, "url", last.Url.String())
+		path, reason, err = crawler.Resume(ctx, state)
+	} else {
+		if *randomStart || *startFlag == "Special:Random" {
+			// Resolve the random article up front, as
+			// the crawl itself doesn't follow Special: pages
+			start, err = wiki.RandomArticle(ctx, prefix)
+			if err == nil {
+				logger.Info("random start", "title", articleTitle(start), "url", start.String())
+			}
+		} else if start == nil {
+			err = errors.New("no start article and no saved state")
+		}
+		if err != nil {
+			fatal("cannot start crawl", "err", err)
+		}
+		if to != nil {
+			path, reason, err = crawler.ShortestPath(ctx, start, to)
+		} else if *bfs {
+			path, reason, err = crawler.Search(ctx, start)
+		} else {
+			path, reason, err = crawler.Crawl(ctx, start)
+		}
+	}
+	elapsed := time.Since(began)
+	saveGraph(crawler.Graph)
+	close(events)
+	<-logged
+	if steps != nil {
+		close(steps)
+	}
+	<-streamed
+	var werr error
+	if !stream {
+		werr = writeResult(out, path, crawler.Visited())
+	}
+	if werr == nil && *format == "ndjson" {
+		werr = writeNDJSONStop(out, path, crawler.Visited(), reason, err)
+	}
+	if out != os.Stdout {
+		if cerr := out.Close(); werr == nil {
+			werr = cerr
+		}
+	}
+	if werr != nil {
+		fatal("cannot write path", "err", werr)
 	}
 
-	// Print path
-	fmt.Printf("=== Link path of length %d ===\n", pageList.Len())
-	i := 0
-	for e := pageList.Front(); e != nil; e = e.Next() {
-		page := e.Value.(*Page)
-		fmt.Printf("Article %d, %s\n", i, strings.TrimPrefix(page.Url.String(), prefix))
-		i++
+	// Keep the stop line out of machine readable output
+	status := os.Stdout
+	if *format != "text" && out == os.Stdout {
+		status = os.Stderr
+	}
+	fmt.Fprintf(status, "Stopped: %s\n", stopMessage(path, reason, err))
+	if *philosophy {
+		if reason == wiki.Matched {
+			fmt.Fprintf(status, "Reached Philosophy in %d hops\n", len(path)-1)
+		} else {
+			fmt.Fprintln(status, "Did not reach Philosophy")
+		}
+	}
+	if n := crawler.Visited(); n > 0 {
+		fmt.Fprintf(status, "Visited %d distinct articles, path length %d\n", n, len(path))
+	}
+	if n := crawler.DeadEnds(); n > 0 {
+		fmt.Fprintf(status, "Backtracked from %d dead ends\n", n)
+	}
+	if n, pages := crawler.Downloaded(); pages > 0 {
+		fmt.Fprintf(status, "Downloaded %s, %s per article\n", formatBytes(n), formatBytes(n/pages))
+	}
+	if *timings {
+		fmt.Fprintf(status, "Took %v, %s\n", elapsed.Round(time.Millisecond), averageHop(path))
+	}
+	writeTraceTotals(status)
+	if reason == wiki.Error {
+		os.Exit(1)
 	}
 }
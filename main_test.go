@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// TestLogEvent checks that the steps of a crawl are logged to the
+// writer of the log handler, stderr or the file of -log-file, which
+// keeps them apart from the path.
+func TestLogEvent(t *testing.T) {
+	defer func(l *slog.Logger) { logger = l }(logger)
+	var progress strings.Builder
+	handler, err := newLogHandler(&progress, "text", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = slog.New(handler)
+
+	path := testPath("Vehicle", "Machine")
+	for i, page := range path {
+		logEvent(wiki.Event{Hop: i, Page: page, Kind: wiki.EventVisited})
+	}
+	logEvent(wiki.Event{Hop: 1, Page: path[1], Kind: wiki.EventDeadEnd})
+	for _, want := range []string{
+		"msg=follow hop=0 title=Vehicle url=https://en.wikipedia.org/wiki/Vehicle",
+		"msg=follow hop=1 title=Machine",
+		`msg="dead end" hop=1 title=Machine`,
+	} {
+		if !strings.Contains(progress.String(), want) {
+			t.Errorf("progress is missing %q:\n%s", want, progress.String())
+		}
+	}
+}
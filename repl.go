@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// replUsage is printed for lines the repl cannot make sense of.
+const replUsage = `enter "start target" to crawl from the start article to the target pattern, or "quit"`
+
+// repl reads "start target" lines from r, crawling from each start
+// article to its target pattern as configured by base and printing
+// the path to w, until r ends, "quit" is read or ctx is done.
+// An interrupt stops only the crawl in progress, if any.
+// The crawls share the client and any cache, so articles fetched
+// by one are not fetched again by the next.
+func repl(ctx context.Context, r io.Reader, w io.Writer, base *wiki.Crawler, writeResult func(w io.Writer, path []*wiki.Page, visited int64) error) error {
+	sc := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !sc.Scan() {
+			fmt.Fprintln(w)
+			return sc.Err()
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		start, pattern, ok := strings.Cut(line, " ")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			fmt.Fprintln(w, replUsage)
+			continue
+		}
+		re, err := compileTarget(pattern)
+		if err != nil {
+			fmt.Fprintf(w, "invalid target pattern %q: %v\n", pattern, err)
+			continue
+		}
+		ur, err := queryStartURL(start)
+		if err != nil {
+			fmt.Fprintf(w, "invalid start article %q: %v\n", start, err)
+			continue
+		}
+
+		// The stop message names the pattern matched
+		targetRegexes = []*regexp.Regexp{re}
+		crawler := base.WithTarget(matchTarget(targetRegexes))
+		// An interrupt or -timeout stops this crawl alone,
+		// back to the prompt
+		qctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		cancel := context.CancelFunc(func() {})
+		if *timeout > 0 {
+			deadlineFrom = time.Now()
+			qctx, cancel = context.WithTimeout(qctx, *timeout)
+		}
+		path, reason, err := crawler.Crawl(qctx, ur)
+		cancel()
+		stop()
+		if werr := writeResult(w, path, crawler.Visited()); werr != nil {
+			return werr
+		}
+		fmt.Fprintf(w, "Stopped: %s\n", stopMessage(path, reason, err))
+		fmt.Fprintf(w, "Visited %d distinct articles, path length %d\n", crawler.Visited(), len(path))
+		if n := crawler.DeadEnds(); n > 0 {
+			fmt.Fprintf(w, "Backtracked from %d dead ends\n", n)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// stallingTransport stalls each request until it is canceled,
+// after sending on its channel that it has begun.
+type stallingTransport chan struct{}
+
+func (s stallingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case s <- struct{}{}:
+	default:
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// TestREPLInterrupt checks that an interrupt stops the crawl of
+// the current query alone, the repl going on to read the next.
+func TestREPLInterrupt(t *testing.T) {
+	defer func(p string) { prefix = p }(prefix)
+	prefix = "https://en.wikipedia.org/wiki/"
+
+	stalled := make(stallingTransport, 1)
+	go func() {
+		<-stalled
+		syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	}()
+	var out strings.Builder
+	base := &wiki.Crawler{Transport: stalled}
+	err := repl(context.Background(), strings.NewReader("Vehicle Philosophy\nquit\n"), &out, base, func(w io.Writer, path []*wiki.Page, visited int64) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "Stopped: interrupted\n") || !strings.HasSuffix(got, "> ") {
+		t.Errorf("repl wrote %q, want the crawl interrupted and another prompt", got)
+	}
+}
+
+// TestREPLTimeout checks that -timeout bounds the crawl of each
+// query, given as a full url, rather than the whole session.
+func TestREPLTimeout(t *testing.T) {
+	defer func(p string, d time.Duration) { prefix, *timeout = p, d }(prefix, *timeout)
+	prefix, *timeout = "https://en.wikipedia.org/wiki/", 50*time.Millisecond
+
+	var out strings.Builder
+	base := &wiki.Crawler{Transport: make(stallingTransport)}
+	queries := "https://en.wikipedia.org/wiki/Vehicle Philosophy\nVehicle Philosophy\nquit\n"
+	err := repl(context.Background(), strings.NewReader(queries), &out, base, func(w io.Writer, path []*wiki.Page, visited int64) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); strings.Count(got, "Stopped: deadline exceeded") != 2 || !strings.HasSuffix(got, "> ") {
+		t.Errorf("repl wrote %q, want both crawls timed out and another prompt", got)
+	}
+}
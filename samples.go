@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// sample is the outcome of a crawl from one of many starts.
+type sample struct {
+	start  *url.URL
+	path   []*wiki.Page
+	reason wiki.StopReason
+	err    error
+}
+
+// runSamples crawls from n random articles with crawler, running
+// at most concurrency crawls at once, and returns their outcomes.
+func runSamples(ctx context.Context, n, concurrency int, crawler *wiki.Crawler) []sample {
+	return runCrawls(ctx, n, concurrency, func(ctx context.Context, i int) (*url.URL, error) {
+		return wiki.RandomArticle(ctx, prefix)
+	}, crawler)
+}
+
+// runStarts crawls from each of starts with crawler, running at
+// most concurrency crawls at once, and returns their outcomes.
+func runStarts(ctx context.Context, starts []*url.URL, concurrency int, crawler *wiki.Crawler) []sample {
+	return runCrawls(ctx, len(starts), concurrency, func(ctx context.Context, i int) (*url.URL, error) {
+		return starts[i], nil
+	}, crawler)
+}
+
+// runCrawls runs n crawls with crawler, the ith from the article
+// startOf returns for i, running at most concurrency crawls at once.
+// Each crawl has its own visited pages, but they share the package's
+// rate limited client. It returns their outcomes in order.
+func runCrawls(ctx context.Context, n, concurrency int, startOf func(ctx context.Context, i int) (*url.URL, error), crawler *wiki.Crawler) []sample {
+	samples := make([]sample, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(i int, s *sample) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start, err := startOf(ctx, i)
+			if err != nil {
+				s.reason, s.err = wiki.Error, err
+				return
+			}
+			s.start = start
+			s.path, s.reason, s.err = crawler.Crawl(ctx, start)
+		}(i, &samples[i])
+	}
+	wg.Wait()
+	return samples
+}
+
+// readStarts returns the urls of the start articles listed one
+// per line in the file at name, skipping blank lines.
+func readStarts(name string) ([]*url.URL, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var starts []*url.URL
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		start, err := startURL(line)
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, start)
+	}
+	return starts, sc.Err()
+}
+
+// writeStartsTable writes a table of the hops each crawl took
+// to reach the target, and why it stopped.
+func writeStartsTable(w io.Writer, samples []sample) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "START\tHOPS\tSTOPPED\n")
+	for _, s := range samples {
+		start, hops := "?", "-"
+		if s.start != nil {
+			start = articleTitle(s.start)
+		}
+		if s.reason == wiki.Matched {
+			hops = strconv.Itoa(len(s.path) - 1)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", start, hops, stopMessage(s.path, s.reason, s.err))
+	}
+	return tw.Flush()
+}
+
+// writeSampleStats writes how many samples reached the target,
+// the mean and median hops taken, a histogram of path lengths,
+// the most common articles the samples converged on by matching
+// or cycling, and the most common cycles entered.
+func writeSampleStats(w io.Writer, samples []sample) {
+	fmt.Fprintf(w, "=== %d samples ===\n", len(samples))
+
+	var hops []int
+	matched, failed := 0, 0
+	lengths := make(map[int]int)
+	// Counts keyed on canonical url, and cycles keyed
+	// on those of their members, along with their names
+	terminals, cycles := make(map[string]int), make(map[string]int)
+	names := make(map[string]string)
+	for _, s := range samples {
+		if s.reason == wiki.Error || len(s.path) == 0 {
+			failed++
+			continue
+		}
+		if s.reason == wiki.Matched {
+			matched++
+		}
+		h := len(s.path) - 1
+		hops = append(hops, h)
+		lengths[h]++
+		if s.reason == wiki.Matched || s.reason == wiki.Cycle {
+			last := s.path[len(s.path)-1]
+			key := wiki.VisitKey(last.Canonical())
+			terminals[key]++
+			names[key] = pageTitle(last)
+		}
+		if s.reason == wiki.Cycle {
+			key, name := cycleKey(cycleMembers(s.path))
+			cycles[key]++
+			names[key] = name
+		}
+	}
+	fmt.Fprintf(w, "Reached target: %d of %d (%.1f%%)\n", matched, len(samples), percent(matched, len(samples)))
+	if failed > 0 {
+		fmt.Fprintf(w, "Failed: %d\n", failed)
+	}
+	if len(hops) == 0 {
+		return
+	}
+
+	sort.Ints(hops)
+	sum := 0
+	for _, h := range hops {
+		sum += h
+	}
+	median := float64(hops[len(hops)/2])
+	if len(hops)%2 == 0 {
+		median = float64(hops[len(hops)/2-1]+hops[len(hops)/2]) / 2
+	}
+	fmt.Fprintf(w, "Hops: mean %.1f, median %.1f\n", float64(sum)/float64(len(hops)), median)
+
+	fmt.Fprintln(w, "Path lengths:")
+	for h := hops[0]; h <= hops[len(hops)-1]; h++ {
+		fmt.Fprintf(w, "%4d %s %d\n", h, strings.Repeat("#", lengths[h]), lengths[h])
+	}
+
+	if len(terminals) > 0 {
+		fmt.Fprintln(w, "Top convergence articles:")
+		writeTop(w, terminals, names, len(samples))
+	}
+	if len(cycles) > 0 {
+		fmt.Fprintln(w, "Top cycles:")
+		writeTop(w, cycles, names, len(samples))
+	}
+}
+
+// writeTop writes the ten keys of counts counted most, by their
+// names, with their counts and percentages of total.
+func writeTop(w io.Writer, counts map[string]int, names map[string]string, total int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return names[keys[i]] < names[keys[j]]
+	})
+	if len(keys) > 10 {
+		keys = keys[:10]
+	}
+	for _, key := range keys {
+		fmt.Fprintf(w, "%4d %5.1f%% %s\n", counts[key], percent(counts[key], total), names[key])
+	}
+}
+
+// cycleKey returns a key and name of the cycle of members, which
+// begin and end with the same article. Both are the same whichever
+// article the cycle was entered at, beginning at the least key.
+func cycleKey(members []*wiki.Page) (string, string) {
+	members = members[:len(members)-1]
+	least := 0
+	for i, page := range members {
+		if wiki.VisitKey(page.Canonical()) < wiki.VisitKey(members[least].Canonical()) {
+			least = i
+		}
+	}
+	keys := make([]string, 0, len(members)+1)
+	titles := make([]string, 0, len(members)+1)
+	for i := 0; i <= len(members); i++ {
+		page := members[(least+i)%len(members)]
+		keys = append(keys, wiki.VisitKey(page.Canonical()))
+		titles = append(titles, pageTitle(page))
+	}
+	return strings.Join(keys, " "), strings.Join(titles, " -> ")
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
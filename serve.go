@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// serveTimeout bounds each crawl served over HTTP
+// when -timeout is not set.
+const serveTimeout = time.Minute
+
+// crawlResponse is the JSON body answering a crawl requested over HTTP.
+type crawlResponse struct {
+	Path       []jsonPage `json:"path,omitempty"`
+	PathLength int        `json:"path_length"`
+	Visited    int64      `json:"visited,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// newCrawlResponse returns the response to a crawl by c
+// which followed path and stopped for reason.
+func newCrawlResponse(c *wiki.Crawler, path []*wiki.Page, reason wiki.StopReason, err error) crawlResponse {
+	res := crawlResponse{Path: jsonPages(path), PathLength: len(path), Visited: c.Visited(), Reason: reason.String()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// serve answers crawls requested over HTTP on addr, each configured
+// as base but for its target, until the server fails. All crawls
+// share wiki.Limiter, so that together they stay polite.
+func serve(addr string, base *wiki.Crawler) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /crawl", func(w http.ResponseWriter, r *http.Request) {
+		serveCrawl(w, r, base)
+	})
+	mux.HandleFunc("GET /crawl/stream", func(w http.ResponseWriter, r *http.Request) {
+		serveStream(w, r, base)
+	})
+	logger.Info("serving", "addr", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// serveCrawl answers GET /crawl?start=Vehicle&target=Car with the
+// path crawled from start to the target pattern, as for -target,
+// which may be repeated to stop at any of them.
+// It answers 404 if start does not exist and 408 if the crawl
+// timed out, along with the path so far.
+func serveCrawl(w http.ResponseWriter, r *http.Request, base *wiki.Crawler) {
+	start, target, err := crawlParams(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, crawlResponse{Error: err.Error()})
+		return
+	}
+	ctx, cancel := crawlContext(r)
+	defer cancel()
+
+	crawler := base.WithTarget(target)
+	path, reason, err := crawler.Crawl(ctx, start)
+	res := newCrawlResponse(crawler, path, reason, err)
+	status := http.StatusOK
+	if err != nil {
+		switch {
+		case errors.Is(err, wiki.ErrArticleNotFound) && len(path) == 1:
+			status = http.StatusNotFound
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusRequestTimeout
+		default:
+			status = http.StatusBadGateway
+		}
+	}
+	writeResponse(w, status, res)
+}
+
+// jsonEvent is the JSON representation of a step of a crawl.
+type jsonEvent struct {
+	Hop  int      `json:"hop"`
+	Kind string   `json:"kind"`
+	Page jsonPage `json:"page"`
+}
+
+// serveStream answers GET /crawl/stream?start=Vehicle&target=Car
+// with Server-Sent Events, an event named by its kind for each step
+// of the crawl as it is made, then a "done" event holding what
+// serveCrawl would answer. The crawl stops if the client goes away.
+func serveStream(w http.ResponseWriter, r *http.Request, base *wiki.Crawler) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeResponse(w, http.StatusInternalServerError, crawlResponse{Error: "streaming is not supported"})
+		return
+	}
+	start, target, err := crawlParams(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, crawlResponse{Error: err.Error()})
+		return
+	}
+	ctx, cancel := crawlContext(r)
+	defer cancel()
+
+	events := make(chan wiki.Event)
+	done := make(chan crawlResponse, 1)
+	go func() {
+		crawler := base.WithTarget(target)
+		path, reason, err := crawler.Crawl(wiki.WithEvents(ctx, events), start)
+		done <- newCrawlResponse(crawler, path, reason, err)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for {
+		select {
+		case e := <-events:
+			writeEvent(w, e.Kind, jsonEvent{Hop: e.Hop, Kind: e.Kind, Page: newJSONPage(e.Hop, e.Page)})
+		case res := <-done:
+			writeEvent(w, "done", res)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes v as the JSON data of a Server-Sent Event
+// named name. Failures are left to the crawl noticing the client
+// has gone away.
+func writeEvent(w http.ResponseWriter, name string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Warn("cannot write event", "err", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+}
+
+// crawlParams returns the start article and target
+// of a crawl requested over HTTP.
+func crawlParams(r *http.Request) (*url.URL, wiki.AcceptFunc, error) {
+	q := r.URL.Query()
+	if q.Get("start") == "" || q.Get("target") == "" {
+		return nil, nil, errors.New("start and target are required")
+	}
+	var res []*regexp.Regexp
+	for _, pattern := range q["target"] {
+		re, err := compileTarget(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid target pattern %q: %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	start, err := queryStartURL(q.Get("start"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, matchTarget(res), nil
+}
+
+// crawlContext returns the context of a crawl requested by r,
+// done when the client goes away or the crawl times out.
+func crawlContext(r *http.Request) (context.Context, context.CancelFunc) {
+	d := serveTimeout
+	if *timeout > 0 {
+		d = *timeout
+	}
+	return context.WithTimeout(r.Context(), d)
+}
+
+// writeResponse writes res as the JSON body of a response with status.
+func writeResponse(w http.ResponseWriter, status int, res crawlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Warn("cannot write response", "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cptaffe/wikicrawl/wiki"
+)
+
+// tuiLines is the most articles of the path shown by the tui,
+// the earlier ones are summarised on a line of their own.
+const tuiLines = 20
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// tui renders the path of a crawl live on a terminal,
+// redrawing it in place with ANSI escapes as it grows.
+type tui struct {
+	w     io.Writer
+	path  []*wiki.Page
+	began time.Time
+
+	// When the last page was reached
+	last time.Time
+
+	// Lines drawn, to be cleared by the next draw
+	lines int
+}
+
+// newTUI returns a tui drawing to w.
+func newTUI(w io.Writer) *tui {
+	now := time.Now()
+	return &tui{w: w, began: now, last: now}
+}
+
+// update applies e to the path shown, without drawing it.
+func (t *tui) update(e wiki.Event) {
+	if e.Hop > len(t.path) {
+		return
+	}
+	switch e.Kind {
+	case wiki.EventVisited:
+		t.path = append(t.path[:e.Hop], e.Page)
+		t.last = time.Now()
+	case wiki.EventBacktracked, wiki.EventDeadEnd:
+		t.path = t.path[:e.Hop]
+	}
+}
+
+// draw redraws the path, the current article, the hop count
+// and how long the current article has taken so far.
+func (t *tui) draw() {
+	t.clear()
+	lines := 0
+	shown := t.path
+	if len(shown) > tuiLines {
+		fmt.Fprintf(t.w, "  ... %d earlier articles\n", len(shown)-tuiLines)
+		lines++
+		shown = shown[len(shown)-tuiLines:]
+	}
+	first := len(t.path) - len(shown)
+	for i, page := range shown {
+		fmt.Fprintf(t.w, "  %3d %s (%v)\n", first+i, pageTitle(page), page.Elapsed.Round(time.Millisecond))
+		lines++
+	}
+	if len(t.path) > 0 {
+		current := t.path[len(t.path)-1]
+		fmt.Fprintf(t.w, "\x1b[1mhop %d, on %s for %v, %v in total\x1b[0m\n",
+			len(t.path)-1, pageTitle(current),
+			time.Since(t.last).Round(100*time.Millisecond),
+			time.Since(t.began).Round(time.Second))
+		lines++
+	}
+	t.lines = lines
+}
+
+// clear erases everything drawn, leaving the cursor where it began.
+func (t *tui) clear() {
+	if t.lines > 0 {
+		fmt.Fprintf(t.w, "\x1b[%dA\x1b[J", t.lines)
+		t.lines = 0
+	}
+}
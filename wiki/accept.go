@@ -0,0 +1,122 @@
+package wiki
+
+import (
+	"net/url"
+	"strings"
+)
+
+// AcceptFunc reports whether a url is accepted,
+// e.g. as a link to follow or as the target of a crawl.
+type AcceptFunc func(*url.URL) bool
+
+// All returns an AcceptFunc accepting urls accepted by every
+// one of fs, checked in order.
+func All(fs ...AcceptFunc) AcceptFunc {
+	return func(ur *url.URL) bool {
+		for _, f := range fs {
+			if !f(ur) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// WithReason returns an AcceptFunc accepting the urls f does,
+// logging each url f rejects along with reason to Logger at
+// debug level.
+func WithReason(reason string, f AcceptFunc) AcceptFunc {
+	return func(ur *url.URL) bool {
+		if f(ur) {
+			return true
+		}
+		Logger.Debug("rejected link", "url", ur.String(), "reason", reason)
+		return false
+	}
+}
+
+// OnWikipedia returns an AcceptFunc accepting urls under prefix,
+// e.g. "https://en.wikipedia.org/wiki/", so that a crawl doesn't
+// leave the world of Wikipedia.
+func OnWikipedia(prefix string) AcceptFunc {
+	return func(ur *url.URL) bool {
+		return strings.HasPrefix(ur.String(), prefix)
+	}
+}
+
+// Namespaces lists the MediaWiki namespaces of pages which are
+// not articles, and their aliases, as used on English Wikipedia.
+// Other Wikipedias' localized names may be appended to it.
+var Namespaces = []string{
+	"Talk", "User", "User talk", "Wikipedia", "Wikipedia talk",
+	"WP", "WT", "Project", "Project talk", "File", "File talk",
+	"Image", "Image talk", "Media", "MediaWiki", "MediaWiki talk",
+	"Template", "Template talk", "Help", "Help talk", "Category",
+	"Category talk", "Portal", "Portal talk", "Draft", "Draft talk",
+	"TimedText", "TimedText talk", "Module", "Module talk",
+	"Special", "Book", "Book talk", "Gadget", "Gadget talk",
+	"Gadget definition", "Gadget definition talk", "Topic",
+}
+
+// inNamespace reports whether title is that of a page
+// in one of Namespaces, e.g. "File:Car.jpg".
+func inNamespace(title string) bool {
+	ns, _, ok := strings.Cut(title, ":")
+	if !ok {
+		return false
+	}
+	ns = strings.TrimSpace(strings.ReplaceAll(ns, "_", " "))
+	for _, n := range Namespaces {
+		if strings.EqualFold(ns, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// badSegment reports whether title has an empty or relative path
+// segment, which no article's title has. Sub pages only exist in
+// Namespaces, so other slashes are part of an article's title, as
+// in "AC/DC" or "OS/2".
+func badSegment(title string) bool {
+	for _, seg := range strings.Split(title, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// ArticleNamespaceOnly returns an AcceptFunc accepting only links
+// to top-level articles. It rejects files and other namespaced
+// pages such as "File:Car.jpg", sub pages, and links to a section
+// of a page. Articles whose titles merely contain a colon, such as
+// "Star Trek: The Next Generation", or a slash, such as "AC/DC",
+// are accepted.
+func ArticleNamespaceOnly() AcceptFunc {
+	return func(ur *url.URL) bool {
+		if !strings.HasPrefix(ur.Path, "/wiki/") || ur.Fragment != "" {
+			return false
+		}
+		str := strings.TrimPrefix(ur.Path, "/wiki/")
+		return str != "" && !inNamespace(str) && !badSegment(str)
+	}
+}
+
+// NotVisited returns an AcceptFunc rejecting urls of pages in visited,
+// which is keyed on canonical url strings as returned by VisitKey.
+func NotVisited(visited map[string]*Page) AcceptFunc {
+	return func(ur *url.URL) bool {
+		_, ok := visited[VisitKey(ur)]
+		return !ok
+	}
+}
+
+// defaultFollow returns the AcceptFunc used by Crawl when none is
+// given, accepting top-level articles on the same Wikipedia as start.
+func defaultFollow(start *url.URL) AcceptFunc {
+	return All(
+		WithReason("not on Wikipedia", OnWikipedia(start.Scheme+"://"+start.Host+"/wiki/")),
+		WithReason("not an article", ArticleNamespaceOnly()),
+	)
+}
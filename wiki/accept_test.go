@@ -0,0 +1,31 @@
+package wiki
+
+import "testing"
+
+// TestArticleNamespaceOnly checks which links ArticleNamespaceOnly
+// takes to be articles.
+func TestArticleNamespaceOnly(t *testing.T) {
+	accept := ArticleNamespaceOnly()
+	for _, tt := range []struct {
+		href string
+		want bool
+	}{
+		{"/wiki/Vehicle", true},
+		{"/wiki/Star_Trek:_The_Next_Generation", true},
+		{"/wiki/Q:_Are_We_Not_Men%3F_A:_We_Are_Devo!", true},
+		{"/wiki/File:Wooden_wheel.jpg", false},
+		{"/wiki/file_talk:Wooden_wheel.jpg", false},
+		{"/wiki/Help:IPA/English", false},
+		{"/wiki/Vehicle#History", false},
+		{"/w/index.php?title=Vehicle", false},
+		{"/wiki/", false},
+	} {
+		ur, err := fixtureURL.Parse(tt.href)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := accept(ur); got != tt.want {
+			t.Errorf("ArticleNamespaceOnly()(%s) = %t, want %t", tt.href, got, tt.want)
+		}
+	}
+}
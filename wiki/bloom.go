@@ -0,0 +1,82 @@
+package wiki
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFalsePositives is the rate of false positives
+// a bloomFilter is sized for.
+const bloomFalsePositives = 0.01
+
+// visitedSet remembers the keys of visited articles.
+type visitedSet interface {
+	has(key string) bool
+	add(key string)
+}
+
+// newVisitedSet returns an exact visitedSet, or if approx
+// is above 0 a bloomFilter sized for that many keys.
+func newVisitedSet(approx int) visitedSet {
+	if approx > 0 {
+		return newBloomFilter(approx)
+	}
+	return exactSet{}
+}
+
+// exactSet is a visitedSet holding every key.
+type exactSet map[string]struct{}
+
+func (s exactSet) has(key string) bool {
+	_, ok := s[key]
+	return ok
+}
+
+func (s exactSet) add(key string) {
+	s[key] = struct{}{}
+}
+
+// bloomFilter is a visitedSet of fixed size which may report
+// a key it was never given as visited, but never the reverse.
+type bloomFilter struct {
+	bits []uint64
+	k    uint64
+}
+
+// newBloomFilter returns a bloomFilter sized for n keys
+// at bloomFalsePositives.
+func newBloomFilter(n int) *bloomFilter {
+	m := math.Ceil(-float64(n) * math.Log(bloomFalsePositives) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(n)*math.Ln2))
+	return &bloomFilter{bits: make([]uint64, (uint64(m)+63)/64), k: uint64(k)}
+}
+
+// locations calls f with each of the k bits of key, derived
+// from two halves of its hash by double hashing.
+func (b *bloomFilter) locations(key string, f func(word int, mask uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % m
+		f(int(bit/64), 1<<(bit%64))
+	}
+}
+
+func (b *bloomFilter) has(key string) bool {
+	found := true
+	b.locations(key, func(word int, mask uint64) {
+		if b.bits[word]&mask == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+func (b *bloomFilter) add(key string) {
+	b.locations(key, func(word int, mask uint64) {
+		b.bits[word] |= mask
+	})
+}
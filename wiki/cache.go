@@ -0,0 +1,126 @@
+package wiki
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache, if set, stores the body of each article fetched,
+// so that later crawls need not download it again.
+var Cache *DiskCache
+
+// DiskCache stores article bodies as files within a directory,
+// named by a hash of the article's canonical url.
+type DiskCache struct {
+	// Directory holding the cached bodies
+	Dir string
+
+	// How long a cached body is used for before it is
+	// revalidated, or 0 to use it forever
+	TTL time.Duration
+}
+
+// cacheEntry is a cached body along with the validators of the
+// response it came from, which are kept in a file of their own.
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Urls the request was redirected to in turn
+	Redirects []string `json:"redirects,omitempty"`
+
+	body []byte
+}
+
+// newCacheEntry returns an entry caching body from resp,
+// whose request was redirected to redirects in turn.
+func newCacheEntry(resp *http.Response, redirects []*url.URL, body []byte) *cacheEntry {
+	return &cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Redirects:    formatURLs(redirects),
+		body:         body,
+	}
+}
+
+// redirects returns the urls the cached request was redirected
+// to in turn, or nil if it was not or any cannot be parsed.
+func (e *cacheEntry) redirects() []*url.URL {
+	chain, _ := parseURLs(e.Redirects)
+	return chain
+}
+
+// file returns the name of the file caching the body at key.
+func (c *DiskCache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// get returns the cached entry at key if there is one,
+// and whether it is no older than TTL.
+func (c *DiskCache) get(key string) (*cacheEntry, bool) {
+	name := c.file(key)
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, false
+	}
+	e := &cacheEntry{}
+	if e.body, err = os.ReadFile(name); err != nil {
+		return nil, false
+	}
+	if b, err := os.ReadFile(name + ".meta"); err == nil {
+		// Without its validators the body is still usable,
+		// it just cannot be revalidated
+		json.Unmarshal(b, e)
+	}
+	return e, c.TTL <= 0 || time.Since(fi.ModTime()) <= c.TTL
+}
+
+// put caches e at key, replacing any cached entry.
+func (c *DiskCache) put(key string, e *cacheEntry) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	name := c.file(key)
+	if err := c.write(name+".meta", meta); err != nil {
+		return err
+	}
+	return c.write(name, e.body)
+}
+
+// touch marks the entry at key as fresh again,
+// after the server said it has not changed.
+func (c *DiskCache) touch(key string) error {
+	now := time.Now()
+	return os.Chtimes(c.file(key), now, now)
+}
+
+// write replaces the file at name with b atomically,
+// so that concurrent crawls never read a partial one.
+func (c *DiskCache) write(name string, b []byte) error {
+	f, err := os.CreateTemp(c.Dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
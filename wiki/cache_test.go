@@ -0,0 +1,54 @@
+package wiki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestCacheNotModified checks that a stale cached article is
+// revalidated with its ETag, and on a 304 response is served
+// from the cache and marked fresh again.
+func TestCacheNotModified(t *testing.T) {
+	var validator string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		validator = r.Header.Get("If-None-Match")
+		if validator == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte(article("Changed")))
+	}))
+	defer srv.Close()
+	defer func(c *DiskCache) { Cache = c }(Cache)
+	Cache = &DiskCache{Dir: t.TempDir(), TTL: time.Hour}
+
+	ur := serverURL(t, srv, "Cached")
+	key := VisitKey(ur)
+	if err := Cache.put(key, &cacheEntry{ETag: `"v1"`, body: []byte(article("Unchanged"))}); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(Cache.file(key), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Crawler{Delay: time.Nanosecond}
+	pg, err := c.FollowLink(context.Background(), &Page{Title: "Cached", Url: ur})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validator != `"v1"` {
+		t.Errorf("revalidated with If-None-Match %q, want %q", validator, `"v1"`)
+	}
+	if pg.Title != "Unchanged" {
+		t.Errorf("followed %s, want Unchanged from the cache", pg.Title)
+	}
+	if _, fresh := Cache.get(key); !fresh {
+		t.Error("cached article is still stale after a 304 response")
+	}
+}
@@ -0,0 +1,336 @@
+// Package wiki crawls Wikipedia by following the first link
+// in each article's text until it reaches an accepted article.
+package wiki
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrCanceled is returned by Crawl, wrapping the context's error,
+// when the crawl is stopped by its context being done.
+var ErrCanceled = errors.New("crawl canceled")
+
+// StopReason describes why a crawl ended.
+type StopReason int
+
+const (
+	// Matched means an accepted article was reached.
+	Matched StopReason = iota
+	// DeadEnd means no article on the path had a link left to follow.
+	DeadEnd
+	// Cycle means the path led back to an article already on it,
+	// the last page of the path is the article it led back to,
+	// or one redirected to it.
+	Cycle
+	// Interrupted means the crawl's context was canceled.
+	Interrupted
+	// Error means a page could not be fetched or parsed.
+	Error
+	// LimitReached means the path reached MaxHops follows.
+	LimitReached
+	// DeadlineExceeded means the crawl's context reached its
+	// deadline, e.g. that of -timeout.
+	DeadlineExceeded
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case Matched:
+		return "matched"
+	case DeadEnd:
+		return "dead end"
+	case Cycle:
+		return "cycle"
+	case Interrupted:
+		return "interrupted"
+	case Error:
+		return "error"
+	case LimitReached:
+		return "limit reached"
+	case DeadlineExceeded:
+		return "deadline exceeded"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// stopped returns why a crawl whose context is done stopped,
+// Interrupted or DeadlineExceeded, and an error wrapping
+// ErrCanceled and the context's error.
+func stopped(ctx context.Context) (StopReason, error) {
+	err := fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return DeadlineExceeded, err
+	}
+	return Interrupted, err
+}
+
+// MaxHops is the most links a crawl follows before stopping,
+// or 0 for no limit.
+var MaxHops = 0
+
+// Logger receives records of what a crawl skipped or failed at.
+var Logger = slog.Default()
+
+// Kinds of Event.
+const (
+	// EventVisited is sent with each page the path reaches.
+	EventVisited = "visited"
+	// EventBacktracked is sent with a page dropped from the path
+	// as its link led nowhere.
+	EventBacktracked = "backtracked"
+	// EventDeadEnd is sent with a page dropped from the path
+	// as it has no link left to follow.
+	EventDeadEnd = "dead-end"
+	// EventMatched is sent with the page accepted as the target.
+	EventMatched = "matched"
+)
+
+// Event is a step of a crawl.
+type Event struct {
+	// Follows from the start to Page
+	Hop int
+
+	// A copy of the page as it was, as the crawl
+	// goes on to change the page itself
+	Page *Page
+
+	// One of the Event kinds, e.g. EventVisited
+	Kind string
+}
+
+// eventsKey is the context key of the channel set by WithEvents.
+type eventsKey struct{}
+
+// WithEvents returns a copy of ctx whose crawls send their events
+// to events rather than their Crawler's Events, so that concurrent
+// crawls can each be followed apart.
+func WithEvents(ctx context.Context, events chan<- Event) context.Context {
+	return context.WithValue(ctx, eventsKey{}, events)
+}
+
+// Crawl follows the first link of each article beginning at start
+// until it reaches an article whose URL is accepted by target.
+// Only links accepted by follow are followed, or if follow is nil
+// links to top-level articles on the same Wikipedia as start, and
+// no article is visited twice.
+// It returns the pages of the path and why the crawl stopped,
+// along with an error if it was interrupted or failed.
+func Crawl(ctx context.Context, start *url.URL, target, follow AcceptFunc) ([]*Page, StopReason, error) {
+	return crawl(ctx, &Crawler{Target: target, Accept: follow}, start)
+}
+
+// crawl crawls from start as configured by c.
+func crawl(ctx context.Context, c *Crawler, start *url.URL) ([]*Page, StopReason, error) {
+	// Initial page to start crawler
+	first := &Page{Title: strings.TrimPrefix(start.Path, "/wiki/"), Url: start}
+
+	// Make sure the start exists before crawling
+	if err := checkExists(ctx, c, start, first.Title); err != nil {
+		if ctx.Err() != nil {
+			reason, err := stopped(ctx)
+			return []*Page{first}, reason, err
+		}
+		return []*Page{first}, Error, err
+	}
+
+	return resume(ctx, c, &State{Path: []*Page{first}})
+}
+
+// Resume continues a crawl from the last page of state's path,
+// as Crawl does, not visiting any page in state again.
+func Resume(ctx context.Context, state *State, target, follow AcceptFunc) ([]*Page, StopReason, error) {
+	return resume(ctx, &Crawler{Target: target, Accept: follow}, state)
+}
+
+// resume resumes the crawl of state as configured by c.
+func resume(ctx context.Context, c *Crawler, state *State) ([]*Page, StopReason, error) {
+	if len(state.Path) == 0 {
+		return nil, Error, errors.New("cannot resume a crawl without a path")
+	}
+	if c.Target == nil {
+		return nil, Error, errors.New("cannot crawl without a target")
+	}
+	target, follow := c.Target, c.accept(state.Path[0].Url)
+	// Pages visited by this crawl alone
+	haveVisited := make(map[string]*Page)
+	for _, page := range state.Visited {
+		haveVisited[VisitKey(page.Url)] = page
+		haveVisited[VisitKey(page.Canonical())] = page
+	}
+	pageList := list.New()
+	for _, page := range state.Path {
+		pageList.PushBack(page)
+	}
+	// Only the last page of the path may be prefetched
+	defer func() {
+		if last := pageList.Back(); last != nil {
+			last.Value.(*Page).dropPrefetch()
+		}
+	}()
+	for {
+		if ctx.Err() != nil {
+			reason, err := stopped(ctx)
+			return pathOf(pageList), reason, err
+		}
+
+		listItem := pageList.Back()
+		page := listItem.Value.(*Page)
+
+		c.emit(ctx, pageList.Len()-1, page, EventVisited)
+
+		if key := VisitKey(page.Url); haveVisited[key] == nil {
+			haveVisited[key] = page
+			c.visited.Add(1)
+		}
+
+		if c.Checkpoint != nil {
+			if err := c.Checkpoint(stateOf(pageList, haveVisited)); err != nil {
+				Logger.Warn("checkpoint failed", "err", err)
+			}
+		}
+
+		if target(page.Url) {
+			c.emit(ctx, pageList.Len()-1, page, EventMatched)
+			return pathOf(pageList), Matched, nil
+		}
+		if max := c.maxHops(); max > 0 && pageList.Len()-1 >= max {
+			return pathOf(pageList), LimitReached, nil
+		}
+
+		// Get next link, remembering the first link
+		// back to a page on the path in case there are
+		// no others to follow
+		var cycle *Page
+		began := time.Now()
+		pg, err := page.followLink(ctx, c, All(
+			// Don't retry links which led nowhere
+			WithReason("already tried", func(ur *url.URL) bool {
+				return !page.tried[VisitKey(ur)]
+			}),
+			func(ur *url.URL) bool {
+				if p, ok := haveVisited[VisitKey(ur)]; ok && cycle == nil && onPath(pageList, ur, nil) {
+					cycle = &Page{Title: p.Title, Url: p.Url, Redirects: p.Redirects}
+				}
+				return true
+			},
+			// Don't Revisit pages
+			WithReason("already visited", func(ur *url.URL) bool {
+				return c.AllowRevisit || NotVisited(haveVisited)(ur)
+			}),
+			follow,
+		))
+		// Abandon a prefetch the link was found without
+		page.dropPrefetch()
+		if page.Redirects != nil && (err == nil || errors.Is(err, ErrNoLink)) {
+			// The page was redirected to the article it is,
+			// which may be the target or already on the path
+			canonical := page.Canonical()
+			haveVisited[VisitKey(canonical)] = page
+			if target(canonical) {
+				c.emit(ctx, pageList.Len()-1, page, EventMatched)
+				return pathOf(pageList), Matched, nil
+			}
+			if onPath(pageList, canonical, listItem) {
+				return pathOf(pageList), Cycle, nil
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// The fetch failed because the crawl was stopped
+				continue
+			}
+			if errors.Is(err, ErrArticleNotFound) || errors.Is(err, ErrRedirectLoop) {
+				// The followed link led nowhere or round a
+				// redirect loop, go back to the page it was on
+				if listItem.Prev() == nil {
+					return pathOf(pageList), Error, err
+				}
+				c.emit(ctx, pageList.Len()-1, page, EventBacktracked)
+				pageList.Remove(listItem)
+				continue
+			}
+			if errors.Is(err, ErrNoLink) {
+				if cycle != nil {
+					// The only links left lead back up the path
+					pageList.PushBack(cycle)
+					return pathOf(pageList), Cycle, nil
+				}
+				// Could not find a link on this file,
+				// drop it and go back up one page
+				c.emit(ctx, pageList.Len()-1, page, EventDeadEnd)
+				c.deadEnds.Add(1)
+				deadEnds.Inc()
+				if listItem.Prev() == nil {
+					return pathOf(pageList), DeadEnd, nil
+				}
+				pageList.Remove(listItem)
+				continue
+			}
+			return pathOf(pageList), Error, err
+		}
+		pg.Elapsed = time.Since(began)
+		if page.tried == nil {
+			page.tried = make(map[string]bool)
+		}
+		page.tried[VisitKey(pg.Url)] = true
+		if c.AllowRevisit && onPath(pageList, pg.Url, nil) {
+			pageList.PushBack(pg)
+			return pathOf(pageList), Cycle, nil
+		}
+		pageList.PushBack(pg)
+		if max := c.maxHops(); c.Prefetch && !target(pg.Url) && (max <= 0 || pageList.Len()-1 < max) {
+			pg.startPrefetch(ctx, c)
+		}
+	}
+}
+
+// onPath reports whether a page in pageList other than that of except
+// is the article at ur, having its url or having been redirected to it.
+func onPath(pageList *list.List, ur *url.URL, except *list.Element) bool {
+	key := VisitKey(ur)
+	for e := pageList.Front(); e != nil; e = e.Next() {
+		page := e.Value.(*Page)
+		if e != except && (VisitKey(page.Url) == key || VisitKey(page.Canonical()) == key) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalURL returns ur without its fragment or query
+// and with a cleaned, unescaped path, so that links to
+// the same article compare equal.
+func canonicalURL(ur *url.URL) url.URL {
+	c := *ur
+	c.Fragment, c.RawFragment = "", ""
+	c.RawQuery, c.ForceQuery = "", false
+	c.RawPath = ""
+	if c.Path != "" {
+		c.Path = path.Clean(c.Path)
+	}
+	return c
+}
+
+// VisitKey returns the string of the canonical form of ur,
+// which keys visited pages.
+func VisitKey(ur *url.URL) string {
+	c := canonicalURL(ur)
+	return c.String()
+}
+
+// pathOf returns the pages in pageList in order.
+func pathOf(pageList *list.List) []*Page {
+	pages := make([]*Page, 0, pageList.Len())
+	for e := pageList.Front(); e != nil; e = e.Next() {
+		pages = append(pages, e.Value.(*Page))
+	}
+	return pages
+}
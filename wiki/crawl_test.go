@@ -0,0 +1,249 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestCrawlLive crawls live Wikipedia from Vehicle to Philosophy,
+// catching changes to its html which break the parser. It runs
+// only when WIKICRAWL_LIVE is set, and not with -short.
+func TestCrawlLive(t *testing.T) {
+	if testing.Short() || os.Getenv("WIKICRAWL_LIVE") == "" {
+		t.Skip("set WIKICRAWL_LIVE to crawl live Wikipedia")
+	}
+	defer func(max int) { MaxHops = max }(MaxHops)
+	MaxHops = 40
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start, err := url.Parse("https://en.wikipedia.org/wiki/Vehicle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := func(ur *url.URL) bool {
+		return strings.TrimPrefix(ur.Path, "/wiki/") == "Philosophy"
+	}
+	path, reason, err := Crawl(ctx, start, target, nil)
+	if err != nil {
+		t.Fatalf("crawl stopped after %d hops: %v", len(path)-1, err)
+	}
+	if reason != Matched {
+		t.Fatalf("crawl stopped after %d hops: %s", len(path)-1, reason)
+	}
+	for i, page := range path {
+		t.Logf("%d %s", i, page.Url)
+	}
+}
+
+// slowTransport delays each request made through it, as a network would.
+type slowTransport struct {
+	http.RoundTripper
+	latency time.Duration
+}
+
+func (s slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	time.Sleep(s.latency)
+	return s.RoundTripper.RoundTrip(req)
+}
+
+// BenchmarkPrefetch crawls a chain of articles fetched with latency,
+// each hop checkpointed as slowly as an article is fetched, with
+// and without the Crawler's Prefetch overlapping the two.
+func BenchmarkPrefetch(b *testing.B) {
+	const hops = 10
+	const latency = 2 * time.Millisecond
+	served := articles{}
+	for i := range hops {
+		served[fmt.Sprintf("Hop_%d", i)] = article(fmt.Sprintf("Hop_%d", i+1))
+	}
+	served[fmt.Sprintf("Hop_%d", hops)] = article()
+	for _, prefetch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prefetch=%t", prefetch), func(b *testing.B) {
+			for b.Loop() {
+				c := testCrawler(slowTransport{served, latency}, fmt.Sprintf("Hop_%d", hops))
+				c.Prefetch = prefetch
+				c.Checkpoint = func(*State) error {
+					time.Sleep(latency)
+					return nil
+				}
+				path, reason, err := c.Crawl(context.Background(), wikiURL("Hop_0"))
+				if err != nil || reason != Matched || len(path) != hops+1 {
+					b.Fatalf("crawl stopped after %d hops: %s %v", len(path)-1, reason, err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed())/float64(b.N*hops), "ns/hop")
+		})
+	}
+}
+
+// TestCrawlDeadEnd checks that a crawl reaching an article with no
+// link drops it from the path, going on from the article before,
+// and counts it among the Crawler's DeadEnds.
+func TestCrawlDeadEnd(t *testing.T) {
+	served := articles{
+		"Start":    article("Middle"),
+		"Middle":   article("Dead_end", "Detour"),
+		"Dead_end": article(),
+		"Detour":   article("Target"),
+		"Target":   article(),
+	}
+	c := testCrawler(served, "Target")
+	path, reason, err := c.Crawl(context.Background(), wikiURL("Start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != Matched {
+		t.Fatalf("crawl stopped: %s", reason)
+	}
+	if got, want := titles(path), []string{"Start", "Middle", "Detour", "Target"}; !slices.Equal(got, want) {
+		t.Errorf("path is %v, want %v", got, want)
+	}
+	if got := c.Visited(); got != 5 {
+		t.Errorf("visited %d articles, want 5", got)
+	}
+	if got := c.DeadEnds(); got != 1 {
+		t.Errorf("backtracked from %d dead ends, want 1", got)
+	}
+}
+
+// TestCrawlNoLink checks that an article whose whole body has no
+// link gives ErrNoLink, wrapping io.EOF, on which a crawl backtracks.
+func TestCrawlNoLink(t *testing.T) {
+	served := map[string]string{
+		"Start":    `<p>Links to <a href="/wiki/Dead_end" title="Dead end">a dead end</a> and <a href="/wiki/Target" title="Target">the target</a>.</p>`,
+		"Dead_end": `<p>Links to nothing.</p>`,
+		"Target":   `<p>Links to nothing.</p>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := served[strings.TrimPrefix(r.URL.Path, "/wiki/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		io.WriteString(w, `<html><body><div id="mw-content-text"><div class="mw-parser-output">`+body+`</div></div></body></html>`)
+	}))
+	defer srv.Close()
+	defer func(l *rate.Limiter) { Limiter = l }(Limiter)
+	Limiter = rate.NewLimiter(rate.Inf, 1)
+
+	deadEnd, err := url.Parse(srv.URL + "/wiki/Dead_end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := func(*url.URL) bool { return true }
+	_, err = (&Page{Title: "Dead_end", Url: deadEnd}).FollowLink(context.Background(), all)
+	if !errors.Is(err, ErrNoLink) || !errors.Is(err, io.EOF) {
+		t.Fatalf("following a link of a dead end returned %v, want %v", err, ErrNoLink)
+	}
+
+	start, err := url.Parse(srv.URL + "/wiki/Start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := func(ur *url.URL) bool { return ur.Path == "/wiki/Target" }
+	path, reason, err := Crawl(context.Background(), start, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != Matched || len(path) != 2 || path[1].Url.Path != "/wiki/Target" {
+		t.Fatalf("crawl stopped after %d hops at %s: %s", len(path)-1, path[len(path)-1].Url, reason)
+	}
+}
+
+// TestVisitKey checks that links to the same article
+// have the same VisitKey, and others do not.
+func TestVisitKey(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		same bool
+	}{
+		{"/wiki/Dog#History", "/wiki/Dog", true},
+		{"/wiki/Dog?oldid=1", "/wiki/Dog", true},
+		{"/wiki/./Dog", "/wiki/Dog", true},
+		{"/wiki/Caf%C3%A9", "/wiki/Café", true},
+		{"/wiki/Dog", "/wiki/Cat", false},
+	} {
+		a, err := fixtureURL.Parse(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := fixtureURL.Parse(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := VisitKey(a) == VisitKey(b); same != tt.same {
+			t.Errorf("VisitKey(%s) == VisitKey(%s) is %t, want %t", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
+
+// TestCrawlsIsolated checks that concurrent crawls by one Crawler
+// each visit the articles the other does, as their visited sets
+// are their own.
+func TestCrawlsIsolated(t *testing.T) {
+	served := articles{
+		"First":  article("Shared"),
+		"Second": article("Shared"),
+		"Shared": article("Target"),
+		"Target": article(),
+	}
+	c := testCrawler(served, "Target")
+	paths := make([][]*Page, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, start := range []string{"First", "Second"} {
+		wg.Go(func() {
+			paths[i], _, errs[i] = c.Crawl(context.Background(), wikiURL(start))
+		})
+	}
+	wg.Wait()
+	for i, start := range []string{"First", "Second"} {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got, want := titles(paths[i]), []string{start, "Shared", "Target"}; !slices.Equal(got, want) {
+			t.Errorf("path is %v, want %v", got, want)
+		}
+	}
+	if got := c.Visited(); got != 6 {
+		t.Errorf("visited %d articles in all, want 6", got)
+	}
+}
+
+// TestCrawlHTTPS checks that the pages of a crawl from an HTTPS start
+// stay on HTTPS, whether linked relatively or absolutely over HTTP.
+func TestCrawlHTTPS(t *testing.T) {
+	served := articles{
+		"Start":   content(`<p>Links to <a href="http://en.wikipedia.org/wiki/Machine" title="Machine">Machine</a>.</p>`),
+		"Machine": article("Target"),
+		"Target":  article(),
+	}
+	c := testCrawler(served, "Target")
+	path, _, err := c.Crawl(context.Background(), wikiURL("Start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := titles(path), []string{"Start", "Machine", "Target"}; !slices.Equal(got, want) {
+		t.Fatalf("path is %v, want %v", got, want)
+	}
+	for _, page := range path {
+		if page.Url.Scheme != "https" {
+			t.Errorf("%s is not on HTTPS", page.Url)
+		}
+	}
+}
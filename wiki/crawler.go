@@ -0,0 +1,314 @@
+package wiki
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Crawler holds the configuration of crawls, so that crawlers
+// configured differently can run in one process. Fields left
+// zero fall back to the package's variables where there is one,
+// e.g. Client and MaxHops, and are otherwise off.
+type Crawler struct {
+	// Wikipedia prefix of articles to follow links to,
+	// e.g. "https://en.wikipedia.org/wiki/". If empty, and
+	// Accept is nil, that of the start article is used.
+	Prefix string
+
+	// Id of the div holding the article content,
+	// ContentID if empty
+	ContentID string
+
+	// Client making every request, Client if nil
+	Client *http.Client
+
+	// Transport, if set, makes every request in place of that
+	// of the client, e.g. to serve canned articles without a
+	// network or to go through a proxy
+	Transport http.RoundTripper
+
+	// Accepts the article to stop at
+	Target AcceptFunc
+
+	// Accepts the links to follow, or if nil links to
+	// top-level articles on Prefix's Wikipedia
+	Accept AcceptFunc
+
+	// Most links followed before stopping, MaxHops if 0
+	MaxHops int
+
+	// Least time between requests of this crawler, or 0
+	// to share Limiter with every other crawl
+	Delay time.Duration
+
+	// Fetch pages from the Wikipedia REST API, which serves
+	// only the article's content rather than the whole page
+	UseAPI bool
+
+	// Rand, if set, makes FollowLink choose a link at random from
+	// the first paragraph with any accepted links, rather than the
+	// first link, for a random walk. Crawlers may share it.
+	Rand *rand.Rand
+
+	// FirstParagraphOnly makes FollowLink only look for a link in
+	// the first paragraph with any text, rather than in each
+	// paragraph in turn until one has a link. Empty paragraphs,
+	// e.g. those holding only coordinates or an image, never
+	// count as the first.
+	FirstParagraphOnly bool
+
+	// IncludeLists makes FollowLink fall back to links in the
+	// first list item or definition with any, when no paragraph
+	// has a link, for articles leading with a list rather than prose.
+	IncludeLists bool
+
+	// LinkIndex, if above 1, makes FollowLink return the accepted
+	// link of that index, counting from 1, rather than the first.
+	// A page with fewer links is a dead end, unless LinkIndexLast
+	// is set.
+	LinkIndex int
+
+	// LinkIndexLast makes FollowLink return the last link of a
+	// page with fewer than LinkIndex links, rather than none.
+	LinkIndexLast bool
+
+	// AllowRevisit makes crawls follow links to articles already
+	// visited, rather than the next link, so that the cycle an
+	// article falls into is followed as it is. A crawl still stops
+	// as soon as it leads back to an article on its path.
+	AllowRevisit bool
+
+	// Prefetch makes crawls begin fetching each article as soon as
+	// the link to it is chosen, while the previous step is reported
+	// and checkpointed, rather than only once that is done.
+	Prefetch bool
+
+	// Graph, if set, remembers the first link of each article found
+	// by FollowLink, so that later crawls need not fetch the article
+	// again to follow it. It is not used with Rand, LinkIndex or
+	// IncludeLists, and should only be shared by crawlers with the
+	// same FirstParagraphOnly and content settings.
+	Graph *LinkGraph
+
+	// ApproxVisited, if above 0, makes Search remember the articles
+	// it has visited in a bloom filter sized for that many, rather
+	// than exactly. Only the visited set is bounded so: the queue
+	// of articles still to expand and the path back from each keep
+	// growing, and ShortestPath and Predecessors remember every
+	// article exactly. The filter wrongly reports about one article
+	// in a hundred as visited once that many are, so a search may
+	// skip a link it should have followed and miss a shorter path.
+	ApproxVisited int
+
+	// Checkpoint, if set, is called with the state of a crawl
+	// before each hop, e.g. to save it so that the crawl can
+	// be resumed.
+	Checkpoint func(*State) error
+
+	// Events, if set, is sent an Event for each step of every
+	// crawl, e.g. to show its progress, unless the crawl's
+	// context has a channel of its own set by WithEvents.
+	// Crawls block until it is received.
+	Events chan<- Event
+
+	once       sync.Once
+	limiter    *rate.Limiter
+	httpClient *http.Client
+
+	// Bytes of article bodies downloaded, and how many
+	downloaded, pages atomic.Int64
+
+	// Distinct articles visited, counted once by each crawl
+	visited atomic.Int64
+
+	// Dead ends backtracked from
+	deadEnds atomic.Int64
+}
+
+// WithTarget returns a Crawler configured as c, but stopping at the
+// articles target accepts, with counts and a limiter of its own.
+func (c *Crawler) WithTarget(target AcceptFunc) *Crawler {
+	return &Crawler{
+		Prefix:             c.Prefix,
+		ContentID:          c.ContentID,
+		Client:             c.Client,
+		Transport:          c.Transport,
+		Target:             target,
+		Accept:             c.Accept,
+		MaxHops:            c.MaxHops,
+		Delay:              c.Delay,
+		UseAPI:             c.UseAPI,
+		Rand:               c.Rand,
+		FirstParagraphOnly: c.FirstParagraphOnly,
+		IncludeLists:       c.IncludeLists,
+		LinkIndex:          c.LinkIndex,
+		LinkIndexLast:      c.LinkIndexLast,
+		AllowRevisit:       c.AllowRevisit,
+		Prefetch:           c.Prefetch,
+		Graph:              c.Graph,
+		ApproxVisited:      c.ApproxVisited,
+		Checkpoint:         c.Checkpoint,
+		Events:             c.Events,
+	}
+}
+
+// Visited returns how many distinct articles c's crawls have
+// visited so far, those backtracked from included, which may be
+// many more than the length of the path found. Each crawl counts
+// an article once however often it is reached, and a resumed
+// crawl does not count those visited before it was saved.
+func (c *Crawler) Visited() int64 {
+	return c.visited.Load()
+}
+
+// DeadEnds returns how many articles without a link to follow
+// c's crawls have reached and backtracked from so far.
+func (c *Crawler) DeadEnds() int64 {
+	return c.deadEnds.Load()
+}
+
+// Downloaded returns the bytes of article bodies c's crawls have
+// downloaded so far, and how many articles they were. Articles
+// read from Cache are not counted.
+func (c *Crawler) Downloaded() (bytes, pages int64) {
+	return c.downloaded.Load(), c.pages.Load()
+}
+
+// count returns body, counting the bytes read from it
+// as downloaded by c if c is not nil.
+func (c *Crawler) count(body io.ReadCloser) io.ReadCloser {
+	if c == nil {
+		return body
+	}
+	c.pages.Add(1)
+	return &countingReader{ReadCloser: body, n: &c.downloaded}
+}
+
+// countingReader adds the bytes read from it to n.
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// Crawl follows the first link of each article beginning at start
+// until it reaches an article accepted by c.Target, as the package's
+// Crawl does.
+func (c *Crawler) Crawl(ctx context.Context, start *url.URL) ([]*Page, StopReason, error) {
+	return crawl(ctx, c, start)
+}
+
+// Resume continues a crawl from the last page of state's path,
+// as the package's Resume does.
+func (c *Crawler) Resume(ctx context.Context, state *State) ([]*Page, StopReason, error) {
+	return resume(ctx, c, state)
+}
+
+// FollowLink returns the first link from page accepted by c.Accept,
+// that of c.LinkIndex if set, or a random one if c.Rand is set.
+// The body of the response from a GET request on the page's Url
+// is parsed for the link by parseFirstLink or parseLinks, unless
+// c.Graph already has it.
+func (c *Crawler) FollowLink(ctx context.Context, page *Page) (*Page, error) {
+	return page.followLink(ctx, c, c.accept(page.Url))
+}
+
+// emit sends an Event to the channel of ctx set by WithEvents,
+// or else to c.Events if set, unless ctx is done.
+func (c *Crawler) emit(ctx context.Context, hop int, page *Page, kind string) {
+	events := c.Events
+	if ch, ok := ctx.Value(eventsKey{}).(chan<- Event); ok {
+		events = ch
+	}
+	if events == nil {
+		return
+	}
+	copied := *page
+	select {
+	case events <- Event{Hop: hop, Page: &copied, Kind: kind}:
+	case <-ctx.Done():
+	}
+}
+
+// accept returns the AcceptFunc of links followed by crawls from start.
+func (c *Crawler) accept(start *url.URL) AcceptFunc {
+	if c.Accept != nil {
+		return c.Accept
+	}
+	if c.Prefix != "" {
+		return All(
+			WithReason("not on Wikipedia", OnWikipedia(c.Prefix)),
+			WithReason("not an article", ArticleNamespaceOnly()),
+		)
+	}
+	return defaultFollow(start)
+}
+
+// setup sets up the limiter and client of c on first use.
+func (c *Crawler) setup() {
+	c.once.Do(func() {
+		if c.Delay > 0 {
+			c.limiter = rate.NewLimiter(rate.Every(c.Delay), 1)
+		}
+		c.httpClient = c.Client
+		if c.httpClient == nil {
+			c.httpClient = Client
+		}
+		if c.Transport != nil {
+			cl := *c.httpClient
+			cl.Transport = c.Transport
+			c.httpClient = &cl
+		}
+	})
+}
+
+// client returns the client making c's requests.
+func (c *Crawler) client() *http.Client {
+	if c == nil {
+		return Client
+	}
+	c.setup()
+	return c.httpClient
+}
+
+// contentDiv returns the id of the div parsed for links,
+// or "" for the whole document when c.UseAPI is set.
+func (c *Crawler) contentDiv() string {
+	if c != nil && c.UseAPI {
+		return ""
+	}
+	if c == nil || c.ContentID == "" {
+		return ContentID
+	}
+	return c.ContentID
+}
+
+// maxHops returns the most links c's crawls follow, or 0 for no limit.
+func (c *Crawler) maxHops() int {
+	if c == nil || c.MaxHops == 0 {
+		return MaxHops
+	}
+	return c.MaxHops
+}
+
+// limit returns the limiter pacing c's requests.
+func (c *Crawler) limit() *rate.Limiter {
+	if c == nil || c.Delay <= 0 {
+		return Limiter
+	}
+	c.setup()
+	return c.limiter
+}
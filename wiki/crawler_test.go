@@ -0,0 +1,138 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// articles is an http.RoundTripper serving canned articles without
+// a network, keyed on their titles. Other titles are not found.
+type articles map[string]string
+
+func (a articles) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := a[strings.TrimPrefix(req.URL.Path, "/wiki/")]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/html; charset=UTF-8"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// article returns the html of an article whose first paragraph
+// links to each of titles in turn.
+func article(titles ...string) string {
+	var b strings.Builder
+	b.WriteString(`<html><body><div id="mw-content-text"><div class="mw-parser-output"><p>Links to`)
+	for _, title := range titles {
+		fmt.Fprintf(&b, ` <a href="/wiki/%s" title="%s">%s</a>`, url.PathEscape(title), title, title)
+	}
+	b.WriteString(`.</p></div></div></body></html>`)
+	return b.String()
+}
+
+// wikiURL returns the url of the article with title on English Wikipedia.
+func wikiURL(title string) *url.URL {
+	return &url.URL{Scheme: "https", Host: "en.wikipedia.org", Path: "/wiki/" + title}
+}
+
+// titled returns an AcceptFunc accepting the article with title.
+func titled(title string) AcceptFunc {
+	return func(ur *url.URL) bool {
+		return ur.Path == "/wiki/"+title
+	}
+}
+
+// testCrawler returns a Crawler of served articles to target,
+// not waiting between requests.
+func testCrawler(served http.RoundTripper, target string) *Crawler {
+	return &Crawler{Transport: served, Target: titled(target), Delay: time.Nanosecond}
+}
+
+// titles returns the title of each page of path.
+func titles(path []*Page) []string {
+	var ts []string
+	for _, page := range path {
+		ts = append(ts, page.Title)
+	}
+	return ts
+}
+
+// TestCrawlerTransport crawls several hops of articles served by
+// a Crawler's Transport, without a network.
+func TestCrawlerTransport(t *testing.T) {
+	served := articles{
+		"Vehicle":    article("Machine", "Transport"),
+		"Machine":    article("Power"),
+		"Power":      article("Physics"),
+		"Physics":    article("Philosophy"),
+		"Philosophy": article("Vehicle"),
+		"Transport":  article("Vehicle"),
+	}
+	c := testCrawler(served, "Philosophy")
+	path, reason, err := c.Crawl(context.Background(), wikiURL("Vehicle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != Matched {
+		t.Fatalf("crawl stopped: %s", reason)
+	}
+	want := []string{"Vehicle", "Machine", "Power", "Physics", "Philosophy"}
+	if got := titles(path); !slices.Equal(got, want) {
+		t.Errorf("path is %v, want %v", got, want)
+	}
+	if got := c.Visited(); got != int64(len(want)) {
+		t.Errorf("visited %d articles, want %d", got, len(want))
+	}
+}
+
+// TestCrawlersConfigured checks that Crawlers configured differently
+// each crawl the same articles as configured, at once, and that one
+// returned by WithTarget keeps the configuration it was made from.
+func TestCrawlersConfigured(t *testing.T) {
+	served := articles{
+		"Start":  article("First", "Second"),
+		"First":  article("Target"),
+		"Second": article("Target"),
+		"Target": article(),
+	}
+	first := testCrawler(served, "Target")
+	second := testCrawler(served, "Target")
+	second.LinkIndex, second.LinkIndexLast = 2, true
+	crawlers := []*Crawler{first, second, second.WithTarget(titled("Second"))}
+	want := [][]string{{"Start", "First", "Target"}, {"Start", "Second", "Target"}, {"Start", "Second"}}
+
+	paths := make([][]*Page, len(crawlers))
+	errs := make([]error, len(crawlers))
+	var wg sync.WaitGroup
+	for i, c := range crawlers {
+		wg.Go(func() {
+			paths[i], _, errs[i] = c.Crawl(context.Background(), wikiURL("Start"))
+		})
+	}
+	wg.Wait()
+	for i := range crawlers {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got := titles(paths[i]); !slices.Equal(got, want[i]) {
+			t.Errorf("path of crawler %d is %v, want %v", i, got, want[i])
+		}
+	}
+}
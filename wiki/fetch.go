@@ -0,0 +1,369 @@
+package wiki
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/time/rate"
+)
+
+// UserAgent is sent with every request. The Wikimedia User-Agent
+// policy asks for a descriptive agent with contact information,
+// and requests without one may be throttled or rejected by the WMF.
+var UserAgent = "wikicrawl/1.0 (https://github.com/cptaffe/wikicrawl)"
+
+// DefaultTimeout bounds each request made by Client.
+const DefaultTimeout = 30 * time.Second
+
+// Client is used for every request made by the package,
+// so that connections to Wikipedia are reused across hops.
+var Client = &http.Client{
+	Timeout:       DefaultTimeout,
+	Transport:     newTransport(),
+	CheckRedirect: checkRedirect,
+}
+
+// MaxRedirects is the most redirects Client follows for a request.
+var MaxRedirects = 10
+
+// ErrRedirectLoop is returned, wrapped with the redirect chain,
+// when a request is redirected back to a url it was already
+// redirected from, or more than MaxRedirects times.
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// checkRedirect stops Client following the redirect to req
+// from those of via if it loops or there are too many.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	seen := false
+	chain := make([]string, 0, len(via)+1)
+	for _, r := range via {
+		chain = append(chain, r.URL.String())
+		if VisitKey(r.URL) == VisitKey(req.URL) {
+			seen = true
+		}
+	}
+	chain = append(chain, req.URL.String())
+	if seen || len(via) >= MaxRedirects {
+		return fmt.Errorf("%w: %s", ErrRedirectLoop, strings.Join(chain, " -> "))
+	}
+	return nil
+}
+
+// newTransport returns a transport keeping enough idle
+// connections per host for a crawl to reuse them.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 4
+	return t
+}
+
+// UseProxy makes every request of Client, those of FollowLink
+// included, go through the proxy at raw, an http, https or socks5
+// url, rather than that given by the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables, which are honored otherwise.
+func UseProxy(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("invalid proxy url %q: scheme must be http, https or socks5", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy url %q: no host", raw)
+	}
+	t, ok := Client.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("cannot set the proxy of a custom transport")
+	}
+	t.Proxy = http.ProxyURL(u)
+	return nil
+}
+
+// MaxRetries is the number of times a request failing with a
+// connection error, a 5xx response or a 429 response is retried.
+var MaxRetries = 3
+
+// RetryBackoff is the delay before the first retry of a request,
+// doubling with each further retry. Some jitter is applied.
+var RetryBackoff = 500 * time.Millisecond
+
+// get performs a GET request on ur with Client,
+// identifying itself with UserAgent.
+// Transient failures are retried up to MaxRetries times,
+// waiting as long as the server asks with Retry-After if it does.
+func get(ctx context.Context, c *Crawler, ur *url.URL) (*http.Response, error) {
+	return send(ctx, c, http.MethodGet, ur, nil)
+}
+
+// getChanged performs a GET request on ur as get does, asking for
+// the body only if it changed since it was cached as e, in which
+// case the response has a status of 304 Not Modified.
+func getChanged(ctx context.Context, c *Crawler, ur *url.URL, e *cacheEntry) (*http.Response, error) {
+	header := make(http.Header)
+	if e.ETag != "" {
+		header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("If-Modified-Since", e.LastModified)
+	}
+	return send(ctx, c, http.MethodGet, ur, header)
+}
+
+// head performs a HEAD request on ur as get does.
+func head(ctx context.Context, c *Crawler, ur *url.URL) (*http.Response, error) {
+	return send(ctx, c, http.MethodHead, ur, nil)
+}
+
+// send performs a request with method and any extra header on ur,
+// retrying transient failures.
+func send(ctx context.Context, c *Crawler, method string, ur *url.URL, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := do(ctx, c, method, ur, header)
+		if attempt >= MaxRetries || ctx.Err() != nil || !transient(resp, err) {
+			return resp, err
+		}
+		retries.Inc()
+		d, ok := retryAfter(resp)
+		if !ok {
+			d = backoff(attempt)
+		}
+		if resp != nil {
+			Logger.Debug("retrying", "url", ur.String(), "status", resp.StatusCode, "delay", d)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			Logger.Debug("retrying", "url", ur.String(), "err", err, "delay", d)
+		}
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Limiter paces every request, to be polite to Wikipedia's servers.
+// It is shared by all crawls so that their total load stays bounded.
+var Limiter = rate.NewLimiter(rate.Every(200*time.Millisecond), 1)
+
+// do performs a single request with method and any extra header
+// on ur with c's client, once allowed by c's limiter.
+func do(ctx context.Context, c *Crawler, method string, ur *url.URL, header http.Header) (*http.Response, error) {
+	if err := c.limit().Wait(ctx); err != nil {
+		return nil, err
+	}
+	if Trace {
+		var timed func()
+		ctx, timed = withTrace(ctx, ur)
+		defer timed()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, ur.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decode replaces the body of resp with its decoding if it has a
+// gzip or deflate Content-Encoding. The transport only decodes
+// responses itself when it asked for the encoding, not when
+// Accept-Encoding was set explicitly or by another transport,
+// and the tokenizer must never be given the raw bytes.
+func decode(resp *http.Response) error {
+	if resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	var r io.ReadCloser
+	var err error
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		r, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		resp.Body.Close()
+		return fmt.Errorf("%s: cannot decode body: %w", resp.Request.URL, err)
+	}
+	resp.Body = &decodedBody{ReadCloser: r, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody reads a decoded body, closing
+// the raw body along with the decoder.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (d *decodedBody) Close() error {
+	d.ReadCloser.Close()
+	return d.raw.Close()
+}
+
+// decodeCharset returns body decoded to UTF-8 from the charset
+// declared by contentType, or by a <meta> element within its first
+// 1024 bytes, for the tokenizer. A body declaring no charset is
+// taken to be UTF-8, rather than guessed to be windows-1252 as
+// browsers do.
+func decodeCharset(body io.ReadCloser, contentType string) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(body, 1024)
+	preview, err := br.Peek(1024)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	_, params, _ := mime.ParseMediaType(contentType)
+	if params["charset"] == "" && !bytes.Contains(bytes.ToLower(preview), []byte("charset")) {
+		return &decodedBody{ReadCloser: io.NopCloser(br), raw: body}, nil
+	}
+	_, name, _ := charset.DetermineEncoding(preview, contentType)
+	if name == "utf-8" {
+		return &decodedBody{ReadCloser: io.NopCloser(br), raw: body}, nil
+	}
+	r, err := charset.NewReaderLabel(name, br)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedBody{ReadCloser: io.NopCloser(r), raw: body}, nil
+}
+
+// transient reports whether a request resulting in resp and err
+// may succeed if retried.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrRedirectLoop)
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter returns the delay asked for by the Retry-After header
+// of a 429 or 503 response, given either in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// maxBackoff bounds the doubled delay before a retry,
+// however many retries came before it.
+const maxBackoff = 5 * time.Minute
+
+// backoff returns the delay before retry number attempt,
+// chosen at random from the upper half of the doubled delay.
+func backoff(attempt int) time.Duration {
+	d := RetryBackoff
+	if d <= 0 {
+		return 0
+	}
+	for range attempt {
+		if d >= maxBackoff/2 {
+			d = maxBackoff
+			break
+		}
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d or for ctx to be done,
+// returning ctx's error in the latter case.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// MaxBody is the most bytes read from the body of each article,
+// or 0 for no limit, so that a pathological page cannot use
+// unbounded memory and time. Most articles are well under it.
+var MaxBody int64 = 8 << 20
+
+// ErrBodyTooLarge is returned, wrapped with the article's URL,
+// when an article's body is longer than MaxBody.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// limitBody returns body, limited to MaxBody bytes if set.
+func limitBody(body io.ReadCloser, ur *url.URL) io.ReadCloser {
+	if MaxBody <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, n: MaxBody, ur: ur}
+}
+
+// limitedBody reads from its body until more than n bytes are read,
+// then fails with ErrBodyTooLarge.
+type limitedBody struct {
+	io.ReadCloser
+	n  int64
+	ur *url.URL
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, fmt.Errorf("%w: %s is over %d bytes", ErrBodyTooLarge, l.ur, MaxBody)
+	}
+	// Read a byte past the limit to tell
+	// a body of exactly n bytes from a longer one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), fmt.Errorf("%w: %s is over %d bytes", ErrBodyTooLarge, l.ur, MaxBody)
+	}
+	return n, err
+}
@@ -0,0 +1,187 @@
+package wiki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+// serverURL returns the url of the article with title on srv.
+func serverURL(t *testing.T, srv *httptest.Server, title string) *url.URL {
+	t.Helper()
+	ur, err := url.Parse(srv.URL + "/wiki/" + title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ur
+}
+
+// TestClientTimeout checks that a request to a server which
+// never answers fails once Client's timeout has passed.
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer func(d time.Duration, n int) { Client.Timeout, MaxRetries = d, n }(Client.Timeout, MaxRetries)
+	Client.Timeout, MaxRetries = 50*time.Millisecond, 0
+
+	began := time.Now()
+	resp, err := get(context.Background(), &Crawler{Delay: time.Nanosecond}, serverURL(t, srv, "Slow"))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a server which never answers succeeded")
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("request failed with %v, want a timeout", err)
+	}
+	if elapsed := time.Since(began); elapsed > 5*time.Second {
+		t.Errorf("request took %v to time out", elapsed)
+	}
+}
+
+// TestFollowLinkGzip checks that an article served gzipped is
+// parsed decoded, whether or not the transport asked for gzip.
+func TestFollowLinkGzip(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(article("Target")))
+	zw.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped.Bytes())
+	}))
+	defer srv.Close()
+
+	for _, disable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("DisableCompression=%t", disable), func(t *testing.T) {
+			c := &Crawler{Transport: &http.Transport{DisableCompression: disable}, Delay: time.Nanosecond}
+			pg, err := c.FollowLink(context.Background(), &Page{Title: "Gzip", Url: serverURL(t, srv, "Gzip")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pg.Title != "Target" {
+				t.Errorf("followed %s, want Target", pg.Url)
+			}
+		})
+	}
+}
+
+// TestRedirectLoop checks that a link redirected round a loop fails
+// with ErrRedirectLoop, and that a crawl backtracks past it.
+func TestRedirectLoop(t *testing.T) {
+	served := articles{
+		"Start":  article("Loop_A", "Target"),
+		"Target": article(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wiki/Loop_A":
+			http.Redirect(w, r, "/wiki/Loop_B", http.StatusMovedPermanently)
+		case "/wiki/Loop_B":
+			http.Redirect(w, r, "/wiki/Loop_A", http.StatusMovedPermanently)
+		default:
+			resp, _ := served.RoundTrip(r)
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Crawler{Target: titled("Target"), Delay: time.Nanosecond}
+	resp, err := get(context.Background(), c, serverURL(t, srv, "Loop_A"))
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("request round the loop returned %v, want %v", err, ErrRedirectLoop)
+	}
+
+	path, reason, err := c.Crawl(context.Background(), serverURL(t, srv, "Start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != Matched {
+		t.Fatalf("crawl stopped: %s", reason)
+	}
+	if got, want := titles(path), []string{"Start", "Target"}; !slices.Equal(got, want) {
+		t.Errorf("path is %v, want %v", got, want)
+	}
+	// Loop_A was visited on the way
+	if got := c.Visited(); got != 3 {
+		t.Errorf("visited %d articles, want 3", got)
+	}
+}
+
+// TestFollowLinkCharset checks that the titles of an article served
+// in ISO-8859-1 are decoded, the charset declared by either the
+// Content-Type header or a <meta> element.
+func TestFollowLinkCharset(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		head        string
+	}{
+		{"header", "text/html; charset=ISO-8859-1", ""},
+		{"meta", "text/html", `<meta charset="ISO-8859-1">`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// "Café" in ISO-8859-1
+			body := "<html><head>" + tt.head + "</head><body>" +
+				`<div id="mw-content-text"><div class="mw-parser-output">` +
+				"<p>A <a href=\"/wiki/Caf%C3%A9\" title=\"Caf\xe9\">caf\xe9</a> sells coffee.</p></div></div></body></html>"
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, body)
+			}))
+			defer srv.Close()
+
+			c := &Crawler{Delay: time.Nanosecond}
+			pg, err := c.FollowLink(context.Background(), &Page{Title: "Coffee", Url: serverURL(t, srv, "Coffee")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pg.Title != "Café" || pg.LinkText != "café" {
+				t.Errorf("followed %q via %q, want Café via café", pg.Title, pg.LinkText)
+			}
+		})
+	}
+}
+
+// TestBackoff checks that the delay before a retry doubles from
+// RetryBackoff up to maxBackoff, even after a great many retries,
+// and that a RetryBackoff of 0 does not wait.
+func TestBackoff(t *testing.T) {
+	defer func(d time.Duration) { RetryBackoff = d }(RetryBackoff)
+	for _, tt := range []struct {
+		initial  time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{time.Second, 0, time.Second / 2, time.Second},
+		{time.Second, 3, 4 * time.Second, 8 * time.Second},
+		{time.Second, 100, maxBackoff / 2, maxBackoff},
+		{time.Hour, 1, maxBackoff / 2, maxBackoff},
+		{0, 5, 0, 0},
+	} {
+		RetryBackoff = tt.initial
+		if d := backoff(tt.attempt); d < tt.min || d > tt.max {
+			t.Errorf("backoff(%d) from %v is %v, want between %v and %v", tt.attempt, tt.initial, d, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package wiki
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// LinkGraph is the relation of articles to their first links,
+// remembered by the crawls of a Crawler whose Graph it is.
+// It marshals to and from JSON, to be kept across runs.
+type LinkGraph struct {
+	// How long a link found is used for, or 0 to use it forever
+	TTL time.Duration
+
+	mu    sync.Mutex
+	links map[string]*graphEntry
+}
+
+// graphEntry is the first link of an article, along with the
+// links before it which the crawl that found it did not accept
+// and so may be accepted by another.
+type graphEntry struct {
+	Skipped   []string  `json:"skipped,omitempty"`
+	Url       string    `json:"url"`
+	Title     string    `json:"title"`
+	LinkText  string    `json:"link_text,omitempty"`
+	Redirects []string  `json:"redirects,omitempty"`
+	Found     time.Time `json:"found"`
+}
+
+// NewLinkGraph returns an empty LinkGraph of links used for ttl.
+func NewLinkGraph(ttl time.Duration) *LinkGraph {
+	return &LinkGraph{TTL: ttl, links: make(map[string]*graphEntry)}
+}
+
+// expired reports whether e is older than the graph's TTL.
+func (g *LinkGraph) expired(e *graphEntry) bool {
+	return g.TTL > 0 && time.Since(e.Found) > g.TTL
+}
+
+// lookup returns the first link from page accepted by acceptFunc
+// if the graph has it, which it does if acceptFunc rejects every
+// link skipped before the one recorded and accepts that one.
+// Any redirects page was found with are recorded on it.
+func (g *LinkGraph) lookup(page *Page, acceptFunc AcceptFunc) (*Page, bool) {
+	g.mu.Lock()
+	e, ok := g.links[VisitKey(page.Url)]
+	g.mu.Unlock()
+	if !ok || g.expired(e) {
+		return nil, false
+	}
+	for _, raw := range e.Skipped {
+		ur, err := url.Parse(raw)
+		if err != nil || acceptFunc(ur) {
+			return nil, false
+		}
+	}
+	ur, err := url.Parse(e.Url)
+	if err != nil || !acceptFunc(ur) {
+		return nil, false
+	}
+	redirects, err := parseURLs(e.Redirects)
+	if err != nil {
+		return nil, false
+	}
+	page.Redirects = redirects
+	return &Page{Title: e.Title, Url: ur, LinkText: e.LinkText}, true
+}
+
+// record records pg as the first link from page,
+// found after skipping those in skipped.
+func (g *LinkGraph) record(page *Page, skipped []*url.URL, pg *Page) {
+	e := &graphEntry{
+		Skipped:   formatURLs(skipped),
+		Url:       pg.Url.String(),
+		Title:     pg.Title,
+		LinkText:  pg.LinkText,
+		Redirects: formatURLs(page.Redirects),
+		Found:     time.Now(),
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links[VisitKey(page.Url)] = e
+}
+
+func (g *LinkGraph) MarshalJSON() ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	links := make(map[string]*graphEntry, len(g.links))
+	for key, e := range g.links {
+		if !g.expired(e) {
+			links[key] = e
+		}
+	}
+	return json.Marshal(links)
+}
+
+func (g *LinkGraph) UnmarshalJSON(b []byte) error {
+	links := make(map[string]*graphEntry)
+	if err := json.Unmarshal(b, &links); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links = links
+	return nil
+}
+
+// formatURLs returns the strings of urls, or nil if there are none.
+func formatURLs(urls []*url.URL) []string {
+	var strs []string
+	for _, ur := range urls {
+		strs = append(strs, ur.String())
+	}
+	return strs
+}
+
+// parseURLs returns the urls of strs, or nil if there are none.
+func parseURLs(strs []string) ([]*url.URL, error) {
+	var urls []*url.URL
+	for _, raw := range strs {
+		ur, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, ur)
+	}
+	return urls, nil
+}
@@ -0,0 +1,45 @@
+package wiki
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics of the work done by every crawl, exported once
+// registered by RegisterMetrics.
+var (
+	pagesFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wikicrawl",
+		Name:      "pages_fetched_total",
+		Help:      "Articles fetched from Wikipedia.",
+	})
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wikicrawl",
+		Name:      "cache_hits_total",
+		Help:      "Articles read from the cache rather than fetched.",
+	})
+	retries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wikicrawl",
+		Name:      "retries_total",
+		Help:      "Requests retried after a transient failure.",
+	})
+	deadEnds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wikicrawl",
+		Name:      "dead_ends_total",
+		Help:      "Articles dropped from a path for having no link to follow.",
+	})
+	fetchSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "wikicrawl",
+		Name:      "fetch_duration_seconds",
+		Help:      "Time taken to fetch each article, retries included.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// RegisterMetrics registers the package's metrics with r,
+// e.g. prometheus.DefaultRegisterer.
+func RegisterMetrics(r prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{pagesFetched, cacheHits, retries, deadEnds, fetchSeconds} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,792 @@
+package wiki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// ContentID is the id of the div holding the main section of the
+// article. Wikipedia uses "mw-content-text", other MediaWiki skins
+// or mirrors may differ.
+var ContentID = "mw-content-text"
+
+// OutputClass is the class of the div within the content div
+// holding the article's prose, "mw-parser-output" on current
+// Wikipedia. If empty, paragraphs directly within the content
+// div are used instead.
+var OutputClass = "mw-parser-output"
+
+// apiURL returns the url of the article at ur on the REST API.
+func apiURL(ur *url.URL) *url.URL {
+	title := strings.TrimPrefix(ur.Path, "/wiki/")
+	return &url.URL{
+		Scheme:  ur.Scheme,
+		Host:    ur.Host,
+		Path:    "/api/rest_v1/page/html/" + title,
+		RawPath: "/api/rest_v1/page/html/" + url.PathEscape(title),
+	}
+}
+
+// articleURL returns the url of the article whose url on the
+// REST API is ur, the inverse of apiURL, or ur if it is not one.
+func articleURL(ur *url.URL) *url.URL {
+	title, ok := strings.CutPrefix(ur.Path, "/api/rest_v1/page/html/")
+	if !ok {
+		return ur
+	}
+	return &url.URL{Scheme: ur.Scheme, Host: ur.Host, Path: "/wiki/" + title}
+}
+
+// skipClasses lists classes of div, span and table elements whose
+// links are never followed, e.g. hatnotes, pronunciation guides
+// and infoboxes.
+var skipClasses = []string{"hatnote", "IPA", "mw-empty-elt", "infobox", "navbox"}
+
+// hasSkipClass reports whether a class attribute value
+// contains any of skipClasses.
+func hasSkipClass(class string) bool {
+	for _, sc := range skipClasses {
+		if hasClass(class, sc) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasClass reports whether a class attribute value contains name.
+func hasClass(class, name string) bool {
+	for _, c := range strings.Fields(class) {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Page serves as a linked list of URLs.
+type Page struct {
+	// String it was redirected with
+	Title string
+
+	// URL of this page
+	Url *url.URL
+
+	// URLs the request for this page was redirected to in turn,
+	// the last being the article it is, or nil if not redirected
+	Redirects []*url.URL
+
+	// Text of the link followed to this page
+	LinkText string
+
+	// Time taken to fetch the previous page and find
+	// the link to this one
+	Elapsed time.Duration
+
+	// Body of this page being downloaded ahead
+	// by startPrefetch, if it is
+	prefetch chan prefetched
+
+	// Links already followed from this page,
+	// which are not followed again on backtracking
+	tried map[string]bool
+}
+
+// Canonical returns the url of the article the page is,
+// the one it was redirected to if it was.
+func (page *Page) Canonical() *url.URL {
+	if len(page.Redirects) > 0 {
+		return page.Redirects[len(page.Redirects)-1]
+	}
+	return page.Url
+}
+
+// redirectsOf returns the urls the request of resp was redirected
+// to in turn, or nil if it was not redirected away from ur.
+// Those on the REST API are returned as the articles' urls.
+func redirectsOf(resp *http.Response, ur *url.URL) []*url.URL {
+	var chain []*url.URL
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		chain = append(chain, articleURL(r.URL))
+	}
+	if len(chain) == 0 || VisitKey(chain[0]) == VisitKey(ur) {
+		return nil
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// ErrNoLink is returned by FollowLink and Links when a page has no
+// link left to accept. It wraps io.EOF, as the whole page was read.
+var ErrNoLink = fmt.Errorf("no link to follow: %w", io.EOF)
+
+// ErrArticleNotFound is returned, wrapped with the article's URL,
+// when an article does not exist.
+var ErrArticleNotFound = errors.New("article not found")
+
+// checkExists returns an error wrapping ErrArticleNotFound
+// if the article at ur does not exist.
+func checkExists(ctx context.Context, c *Crawler, ur *url.URL, title string) error {
+	resp, err := head(ctx, c, ur)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %q at %s", ErrArticleNotFound, title, ur)
+	}
+	return nil
+}
+
+// RandomArticle returns the url of a random article on the
+// Wikipedia with the given prefix, e.g. "https://en.wikipedia.org/wiki/",
+// by following the redirect of its Special:Random page.
+func RandomArticle(ctx context.Context, prefix string) (*url.URL, error) {
+	ur, err := url.Parse(prefix + "Special:Random")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := head(ctx, nil, ur)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: unexpected status %s", ur, resp.Status)
+	}
+	return resp.Request.URL, nil
+}
+
+// fetch returns the body of a successful GET request on the
+// Page's Url, or its REST API url if c.UseAPI is set. Closing it
+// drains it first, so that the connection can be reused by the
+// next hop. If Cache is set the body is read from it instead
+// when cached, and otherwise read in full and cached. A cached
+// body older than the cache's TTL is used only if the server
+// says it has not changed since. The body is decoded to UTF-8 from
+// any charset it declares, and cached decoded. Any redirects the
+// request followed are recorded as the Page's Redirects.
+// If the Page was prefetched the body fetched then is returned.
+func (page *Page) fetch(ctx context.Context, c *Crawler) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	var redirects []*url.URL
+	var err error
+	if page.prefetch != nil {
+		p := <-page.prefetch
+		page.prefetch = nil
+		body, redirects, err = p.body, p.redirects, p.err
+	} else {
+		body, redirects, err = page.download(ctx, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	page.Redirects = redirects
+	return body, nil
+}
+
+// prefetched is the result of a Page's download ahead of its fetch.
+type prefetched struct {
+	body      io.ReadCloser
+	redirects []*url.URL
+	err       error
+}
+
+// startPrefetch begins downloading the Page for its next fetch,
+// which then need not wait as long.
+func (page *Page) startPrefetch(ctx context.Context, c *Crawler) {
+	ch := make(chan prefetched, 1)
+	page.prefetch = ch
+	go func() {
+		body, redirects, err := page.download(ctx, c)
+		ch <- prefetched{body: body, redirects: redirects, err: err}
+	}()
+}
+
+// dropPrefetch abandons any download of the Page begun by
+// startPrefetch and not yet fetched, closing its body.
+func (page *Page) dropPrefetch() {
+	if page.prefetch == nil {
+		return
+	}
+	go func(ch <-chan prefetched) {
+		if p := <-ch; p.body != nil {
+			p.body.Close()
+		}
+	}(page.prefetch)
+	page.prefetch = nil
+}
+
+// download returns the body of the Page as fetch does, along with
+// the redirects the request followed, without changing the Page,
+// so that it may run alongside the crawl.
+func (page *Page) download(ctx context.Context, c *Crawler) (io.ReadCloser, []*url.URL, error) {
+	ur := page.Url
+	if c.UseAPI {
+		ur = apiURL(ur)
+	}
+	key := VisitKey(ur)
+	var cached *cacheEntry
+	if Cache != nil {
+		e, fresh := Cache.get(key)
+		if fresh {
+			Logger.Debug("cache hit", "url", page.Url.String())
+			cacheHits.Inc()
+			return io.NopCloser(bytes.NewReader(e.body)), e.redirects(), nil
+		}
+		cached = e
+	}
+	var resp *http.Response
+	var err error
+	began := time.Now()
+	if cached != nil {
+		resp, err = getChanged(ctx, c, ur, cached)
+	} else {
+		resp, err = get(ctx, c, ur)
+	}
+	fetchSeconds.Observe(time.Since(began).Seconds())
+	if err != nil {
+		return nil, nil, err
+	}
+	body := &drainCloser{limitBody(c.count(resp.Body), page.Url)}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		body.Close()
+		Logger.Debug("cache revalidated", "url", page.Url.String())
+		cacheHits.Inc()
+		if err := Cache.touch(key); err != nil {
+			Logger.Warn("cannot cache page", "url", page.Url.String(), "err", err)
+		}
+		return io.NopCloser(bytes.NewReader(cached.body)), cached.redirects(), nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		body.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrArticleNotFound, page.Url)
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body.Close()
+		return nil, nil, fmt.Errorf("%s: unexpected status %s", page.Url, resp.Status)
+	}
+	pagesFetched.Inc()
+	redirects := redirectsOf(resp, page.Url)
+	decoded, err := decodeCharset(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		body.Close()
+		return nil, nil, fmt.Errorf("%s: cannot decode body: %w", page.Url, err)
+	}
+	if Cache == nil {
+		return decoded, redirects, nil
+	}
+	defer decoded.Close()
+	b, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := Cache.put(key, newCacheEntry(resp, redirects, b)); err != nil {
+		Logger.Warn("cannot cache page", "url", page.Url.String(), "err", err)
+	}
+	return io.NopCloser(bytes.NewReader(b)), redirects, nil
+}
+
+// drainCloser drains the rest of its body when closed.
+type drainCloser struct {
+	io.ReadCloser
+}
+
+func (d *drainCloser) Close() error {
+	io.Copy(io.Discard, d.ReadCloser)
+	return d.ReadCloser.Close()
+}
+
+// randMu guards the Rand of each Crawler, which is not safe for
+// concurrent use and may be shared.
+var randMu sync.Mutex
+
+// FollowLink returns the first accepted link from a Page.
+// The body of the response from a GET request on the Page's Url
+// is parsed for the link by parseFirstLink.
+func (page *Page) FollowLink(ctx context.Context, acceptFunc AcceptFunc) (*Page, error) {
+	return page.followLink(ctx, &Crawler{}, acceptFunc)
+}
+
+// followLink returns the link from a Page accepted by acceptFunc
+// as c.FollowLink does, fetching it as configured by c.
+func (page *Page) followLink(ctx context.Context, c *Crawler, acceptFunc AcceptFunc) (*Page, error) {
+	graph := c.Graph != nil && c.Rand == nil && c.LinkIndex <= 1 && !c.IncludeLists
+	if graph {
+		if pg, ok := c.Graph.lookup(page, acceptFunc); ok {
+			return pg, nil
+		}
+	}
+	body, err := page.fetch(ctx, c)
+	if err != nil {
+		return page, err
+	}
+	defer body.Close()
+
+	if c.Rand != nil {
+		links, err := parseLinks(body, page.Url, c.contentDiv(), acceptFunc, linkScan{firstParagraph: true, onlyFirst: c.FirstParagraphOnly, lists: c.IncludeLists})
+		if err != nil {
+			return page, err
+		}
+		randMu.Lock()
+		defer randMu.Unlock()
+		return links[c.Rand.Intn(len(links))], nil
+	}
+
+	if c.LinkIndex > 1 {
+		links, err := parseLinks(body, page.Url, c.contentDiv(), acceptFunc, linkScan{limit: c.LinkIndex, onlyFirst: c.FirstParagraphOnly, lists: c.IncludeLists})
+		if err != nil {
+			return page, err
+		}
+		if len(links) < c.LinkIndex {
+			if !c.LinkIndexLast {
+				return page, ErrNoLink
+			}
+			return links[len(links)-1], nil
+		}
+		return links[c.LinkIndex-1], nil
+	}
+
+	// Remember the links skipped on the way to the first, as
+	// another crawl consulting the graph may accept one of them
+	var skipped []*url.URL
+	accept := acceptFunc
+	if graph {
+		accept = func(ur *url.URL) bool {
+			if acceptFunc(ur) {
+				return true
+			}
+			skipped = append(skipped, ur)
+			return false
+		}
+	}
+	pg, err := parseFirstLink(body, page.Url, c.contentDiv(), accept, linkScan{onlyFirst: c.FirstParagraphOnly, lists: c.IncludeLists})
+	if err != nil {
+		return page, err
+	}
+	if graph {
+		c.Graph.record(page, skipped, pg)
+	}
+	return pg, nil
+}
+
+// Links returns every accepted link from a Page, in document order.
+// The body of the response from a GET request on the Page's Url
+// is parsed for links anywhere within the content div by parseLinks,
+// without the rules FollowLink uses to skip links.
+func (page *Page) Links(ctx context.Context, acceptFunc AcceptFunc) ([]*Page, error) {
+	return page.links(ctx, &Crawler{}, acceptFunc)
+}
+
+// links returns every link from a Page accepted by acceptFunc
+// as Links does, fetching it as configured by c.
+func (page *Page) links(ctx context.Context, c *Crawler, acceptFunc AcceptFunc) ([]*Page, error) {
+	body, err := page.fetch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return parseLinks(body, page.Url, c.contentDiv(), acceptFunc, linkScan{all: true})
+}
+
+// parseFirstLink returns the first accepted link in r, as found
+// by parseLinks stopping at the first paragraph with one and
+// otherwise scanning as scan says.
+func parseFirstLink(r io.Reader, base *url.URL, contentID string, acceptFunc AcceptFunc, scan linkScan) (*Page, error) {
+	scan.limit, scan.firstParagraph = 1, true
+	links, err := parseLinks(r, base, contentID, acceptFunc, scan)
+	if err != nil {
+		return nil, err
+	}
+	return links[0], nil
+}
+
+// linkScan configures which links parseLinks returns.
+type linkScan struct {
+	// Stop once this many links are found, if positive
+	limit int
+
+	// Stop at the end of the first paragraph with any links
+	firstParagraph bool
+
+	// Stop at the end of the first paragraph with any text,
+	// whether or not it has links
+	onlyFirst bool
+
+	// Fall back to the links of the first <li> or <dd>
+	// with any when no paragraph has links
+	lists bool
+
+	// Return every link within the content div rather
+	// than only those the first-link rules allow
+	all bool
+}
+
+// parseLinks returns accepted links in r in document order,
+// as configured by scan.
+// If no link is accepted ErrNoLink is returned, or the tokenizer's
+// error if it failed before reaching the end of r.
+// r is parsed as html for a <p> tag directly within a <div> tag
+// with a class of OutputClass within a <div> tag with an id
+// attribute matching contentID, and links are resolved against base.
+// An empty contentID takes the whole document as the content div,
+// as the REST API serves, whose paragraphs are within sections.
+// An accepted html tag sequence may look like the following
+// psuedo regex expression:
+// <div id={contentID}><div class={OutputClass}><p>+<a href={accepted url}>...
+// Paragraphs within tables or further divs are not considered.
+// With scan.lists, <li> and <dd> tags placed as paragraphs are too,
+// their links returned only if no paragraph has any.
+// Links enclosed in parentheses, italics or superscripts within
+// the paragraph are skipped, as are links within tables and within
+// a div, span or table having one of skipClasses. Red links, with a
+// class of "new" as they are to articles which do not exist, are
+// always skipped.
+func parseLinks(r io.Reader, base *url.URL, contentID string, acceptFunc AcceptFunc, scan linkScan) ([]*Page, error) {
+	var links []*Page
+	z := html.NewTokenizer(r)
+	// Skipped links are only described if they would be logged
+	debug := Logger.Enabled(context.Background(), slog.LevelDebug)
+	inBody := contentID == ""
+	inP := 0
+	// Nesting of list items, and the links of the first with any
+	inItem := 0
+	var itemLinks []*Page
+	itemDone := false
+	depth := 0
+	// Depth of the output div, or -1 outside of it,
+	// and the nesting of tables within the body
+	outputDepth := -1
+	inTable := 0
+	paren := 0
+	// Whether any paragraph so far had text
+	pText := false
+	inItalic := 0
+	inSup := 0
+	// Whether each open div, span and table within the body
+	// has one of skipClasses, and how many of them do.
+	var divSkip, spanSkip, tableSkip []bool
+	skip := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if len(links) > 0 {
+				return links, nil
+			}
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			if len(itemLinks) > 0 {
+				return itemLinks, nil
+			}
+			return nil, ErrNoLink
+		case html.TextToken:
+			if inP > 0 || inItem > 0 {
+				// Text may only be read once per token
+				text := z.Text()
+				if inP > 0 && !pText && len(bytes.TrimSpace(text)) > 0 {
+					pText = true
+				}
+				// Track parenthesis depth across text tokens,
+				// links within parentheses are not followed.
+				for _, c := range text {
+					if c == '(' {
+						paren++
+					} else if c == ')' && paren > 0 {
+						paren--
+					}
+				}
+			}
+		case html.StartTagToken, html.EndTagToken:
+			tn, _ := z.TagName()
+			if string(tn) == "div" {
+				if tt == html.StartTagToken {
+					// Loop through attributes for an id and class
+					id, class := "", ""
+					more := true
+					for more {
+						key, val, m := z.TagAttr()
+						more = m
+						if string(key) == "id" {
+							id = string(val)
+						} else if string(key) == "class" {
+							class = string(val)
+						}
+					}
+					if inBody {
+						// Descend into an inner div
+						depth++
+						if outputDepth < 0 && OutputClass != "" && hasClass(class, OutputClass) {
+							outputDepth = depth
+						}
+						ex := hasSkipClass(class)
+						divSkip = append(divSkip, ex)
+						if ex {
+							skip++
+						}
+					} else if id == contentID {
+						inBody = true
+					}
+				} else if inBody {
+					if depth == 0 {
+						inBody = contentID == ""
+					} else {
+						if depth == outputDepth {
+							outputDepth = -1
+						}
+						depth--
+						if divSkip[len(divSkip)-1] {
+							skip--
+						}
+						divSkip = divSkip[:len(divSkip)-1]
+					}
+				}
+			} else if inBody && string(tn) == "span" {
+				if tt == html.StartTagToken {
+					class := ""
+					more := true
+					for more {
+						key, val, m := z.TagAttr()
+						more = m
+						if string(key) == "class" {
+							class = string(val)
+						}
+					}
+					ex := hasSkipClass(class)
+					spanSkip = append(spanSkip, ex)
+					if ex {
+						skip++
+					}
+				} else if len(spanSkip) > 0 {
+					if spanSkip[len(spanSkip)-1] {
+						skip--
+					}
+					spanSkip = spanSkip[:len(spanSkip)-1]
+				}
+			} else if inBody && string(tn) == "table" {
+				if tt == html.StartTagToken {
+					class := ""
+					more := true
+					for more {
+						key, val, m := z.TagAttr()
+						more = m
+						if string(key) == "class" {
+							class = string(val)
+						}
+					}
+					inTable++
+					ex := hasSkipClass(class)
+					tableSkip = append(tableSkip, ex)
+					if ex {
+						skip++
+					}
+				} else if inTable > 0 {
+					inTable--
+					if tableSkip[len(tableSkip)-1] {
+						skip--
+					}
+					tableSkip = tableSkip[:len(tableSkip)-1]
+				}
+			} else if inBody && string(tn) == "p" {
+				// Only paragraphs of the prose itself count
+				direct := depth == outputDepth || ((OutputClass == "" || contentID == "") && depth == 0)
+				if tt == html.StartTagToken {
+					if direct && inTable == 0 {
+						if inP == 0 && inItem == 0 {
+							paren = 0
+						}
+						inP++
+					}
+				} else if inP > 0 {
+					inP--
+					if inP == 0 && scan.firstParagraph && len(links) > 0 {
+						return links, nil
+					}
+					if inP == 0 && scan.onlyFirst && pText {
+						if len(links) > 0 {
+							return links, nil
+						}
+						if len(itemLinks) > 0 {
+							return itemLinks, nil
+						}
+						return nil, ErrNoLink
+					}
+				}
+			} else if scan.lists && inBody && (string(tn) == "li" || string(tn) == "dd") {
+				// List items of the prose itself, as for paragraphs
+				direct := depth == outputDepth || ((OutputClass == "" || contentID == "") && depth == 0)
+				if tt == html.StartTagToken {
+					if (direct && inTable == 0) || inItem > 0 {
+						if inP == 0 && inItem == 0 {
+							paren = 0
+						}
+						inItem++
+					}
+				} else if inItem > 0 {
+					inItem--
+					if inItem == 0 && len(itemLinks) > 0 {
+						itemDone = true
+					}
+				}
+			} else if (inP > 0 || inItem > 0) && (string(tn) == "i" || string(tn) == "em") {
+				if tt == html.StartTagToken {
+					inItalic++
+				} else if inItalic > 0 {
+					inItalic--
+				}
+			} else if (inP > 0 || inItem > 0) && string(tn) == "sup" {
+				// Superscripts hold citation markers like [1]
+				if tt == html.StartTagToken {
+					inSup++
+				} else if inSup > 0 {
+					inSup--
+				}
+			} else if (inP > 0 || inItem > 0 || (scan.all && inBody)) && tt == html.StartTagToken && string(tn) == "a" {
+				// This is an anchor tag
+				// This is an anchor tag in a div
+				// Check if it has an href attribute. The
+				// attributes are only valid until the next
+				// token, and a Page is only made for a link
+				// once it is accepted.
+				more := true
+				var ur *url.URL
+				var title, class []byte
+				for more {
+					key, val, m := z.TagAttr()
+					more = m
+					if bytes.Equal(key, hrefAttr) {
+						// Parse URL
+						u, err := base.Parse(string(val))
+						if err != nil {
+							// If this url is not parseable,
+							// skip to the second url
+							break
+						}
+						// Relative links inherit the scheme of
+						// the page, but absolute links back to
+						// the same host may still say http.
+						if u.Scheme == "http" && base.Scheme == "https" && u.Host == base.Host {
+							u.Scheme = "https"
+						}
+						ur = u
+					} else if bytes.Equal(key, titleAttr) {
+						title = val
+					} else if bytes.Equal(key, classAttr) {
+						class = val
+					}
+				}
+				if ur == nil {
+					continue
+				}
+				if classHas(class, "new") {
+					// A red link, to an article which does
+					// not exist, leads to its edit page
+					if debug {
+						Logger.Debug("skipped link", "url", ur.String(), "reason", "red link")
+					}
+					continue
+				}
+				if why := skipReason(paren, inItalic, inSup, inTable, skip); why != "" && !scan.all {
+					if debug {
+						Logger.Debug("skipped link", "url", ur.String(), "reason", why)
+					}
+					continue
+				}
+				if acceptFunc(ur) {
+					pg := &Page{Title: string(title), Url: ur}
+					pg.LinkText = anchorText(z)
+					// The link's text is the paragraph's too,
+					// though read here rather than as a text token
+					if inP > 0 && pg.LinkText != "" {
+						pText = true
+					}
+					if pg.Title == "" {
+						pg.Title = pg.LinkText
+					}
+					if inP == 0 && inItem > 0 && !scan.all {
+						// Kept in case no paragraph has a link
+						if !itemDone {
+							itemLinks = append(itemLinks, pg)
+						}
+						continue
+					}
+					links = append(links, pg)
+					if scan.limit > 0 && len(links) >= scan.limit {
+						return links, nil
+					}
+				}
+			}
+		}
+	}
+}
+
+// Names of the attributes of an anchor tag read by parseLinks.
+var (
+	hrefAttr  = []byte("href")
+	titleAttr = []byte("title")
+	classAttr = []byte("class")
+)
+
+// classHas reports whether a class attribute value contains name,
+// as hasClass does, without making a string of it.
+func classHas(class []byte, name string) bool {
+	for len(class) > 0 {
+		end := bytes.IndexAny(class, " \t\n\f\r")
+		if end < 0 {
+			return string(class) == name
+		}
+		if string(class[:end]) == name {
+			return true
+		}
+		class = class[end+1:]
+	}
+	return false
+}
+
+// skipReason returns why an anchor within the given nesting of
+// parentheses, italics, superscripts, tables and elements with
+// skipClasses is not followed, or "" if it may be.
+func skipReason(paren, inItalic, inSup, inTable, skip int) string {
+	switch {
+	case paren > 0:
+		return "in parentheses"
+	case inItalic > 0:
+		return "in italics"
+	case inSup > 0:
+		return "in a superscript"
+	case inTable > 0:
+		return "in a table"
+	case skip > 0:
+		return "in a skipped element"
+	}
+	return ""
+}
+
+// anchorText reads tokens from z up to the end of the
+// current anchor tag, returning the text within it.
+func anchorText(z *html.Tokenizer) string {
+	var b strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(b.String())
+		case html.TextToken:
+			b.Write(z.Text())
+		case html.EndTagToken:
+			if tn, _ := z.TagName(); string(tn) == "a" {
+				return strings.TrimSpace(b.String())
+			}
+		}
+	}
+}
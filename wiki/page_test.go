@@ -0,0 +1,236 @@
+package wiki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// fixtureURL is the url fixtures are parsed as if fetched from.
+var fixtureURL = &url.URL{Scheme: "https", Host: "en.wikipedia.org", Path: "/wiki/Fixture"}
+
+// fixtureAccept accepts the links followed from fixtures.
+var fixtureAccept = defaultFollow(fixtureURL)
+
+// fixtures returns the paths of the article fixtures in testdata.
+func fixtures(t testing.TB) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+	return paths
+}
+
+// parseFixture returns the first link of the fixture at path.
+func parseFixture(t *testing.T, path string) (*Page, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return parseFirstLink(f, fixtureURL, ContentID, fixtureAccept, linkScan{})
+}
+
+// TestParseFirstLink checks the first link of each fixture in
+// testdata against the url in its golden file, e.g. that
+// links in parentheses, italics, infoboxes and red links
+// are passed over. Run with -update to rewrite the golden files.
+func TestParseFirstLink(t *testing.T) {
+	for _, path := range fixtures(t) {
+		name := strings.TrimSuffix(filepath.Base(path), ".html")
+		t.Run(name, func(t *testing.T) {
+			pg, err := parseFixture(t, path)
+			if err != nil {
+				t.Fatalf("parseFirstLink: %v", err)
+			}
+			got := pg.Url.String()
+			golden := strings.TrimSuffix(path, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != strings.TrimSpace(string(want)) {
+				t.Errorf("first link is %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// FuzzParseFirstLink checks that parseFirstLink never panics and
+// returns either a link or an error, whatever html it is given.
+func FuzzParseFirstLink(f *testing.F) {
+	for _, path := range fixtures(f) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		pg, err := parseFirstLink(bytes.NewReader(b), fixtureURL, ContentID, fixtureAccept, linkScan{})
+		if (pg == nil) == (err == nil) {
+			t.Fatalf("parseFirstLink returned %v and %v, want a link or an error", pg, err)
+		}
+		if pg != nil && pg.Url == nil {
+			t.Fatal("parseFirstLink returned a link without a url")
+		}
+	})
+}
+
+// largeArticle returns the html of an article with an infobox and
+// the given number of paragraphs before the last, each of whose links
+// is skipped, as they are in parentheses, italics, citations or
+// other namespaces. The last paragraph links to Target.
+func largeArticle(paragraphs int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<!DOCTYPE html><html><head><title>Large - Wikipedia</title></head><body>`)
+	b.WriteString(`<div id="mw-content-text" class="mw-body-content"><div class="mw-content-ltr mw-parser-output">`)
+	b.WriteString(`<table class="infobox"><tbody>`)
+	for i := range 50 {
+		fmt.Fprintf(&b, `<tr><th class="infobox-label">Field %d</th><td class="infobox-data"><a href="/wiki/Infobox_%d" title="Infobox %d">Value %d</a></td></tr>`, i, i, i, i)
+	}
+	b.WriteString(`</tbody></table>`)
+	for i := range paragraphs {
+		fmt.Fprintf(&b, `<p>Paragraph %d (see <a href="/wiki/Aside_%d" title="Aside %d">aside</a>) on `, i, i, i)
+		fmt.Fprintf(&b, `<i><a href="/wiki/Work_%d" title="Work %d">a work</a></i>, `, i, i)
+		fmt.Fprintf(&b, `as <a href="/wiki/Help:IPA_%d" title="Help:IPA">pronounced</a>.`, i)
+		fmt.Fprintf(&b, `<sup class="reference"><a href="#cite_note-%d">[%d]</a></sup></p>`, i, i)
+	}
+	b.WriteString(`<p>The last paragraph links to the <a href="/wiki/Target" title="Target">target</a>.</p>`)
+	b.WriteString(`</div></div></body></html>`)
+	return b.Bytes()
+}
+
+// BenchmarkParseFirstLink parses a large article, scanning and
+// skipping every anchor before the link in its last paragraph.
+func BenchmarkParseFirstLink(b *testing.B) {
+	article := largeArticle(300)
+	b.SetBytes(int64(len(article)))
+	b.ReportAllocs()
+	for b.Loop() {
+		pg, err := parseFirstLink(bytes.NewReader(article), fixtureURL, ContentID, fixtureAccept, linkScan{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if pg.Title != "Target" {
+			b.Fatalf("first link is %s, want Target", pg.Url)
+		}
+	}
+}
+
+// TestFollowLinkIndexLast checks that with LinkIndex beyond the
+// links of the only paragraph looked at, LinkIndexLast returns
+// the last of them.
+func TestFollowLinkIndexLast(t *testing.T) {
+	served := articles{"Start": `<div id="mw-content-text"><div class="mw-parser-output">` +
+		`<p>Text <a href="/wiki/One" title="One">One</a></p>` +
+		`<p>More <a href="/wiki/Two" title="Two">Two</a></p></div></div>`}
+	c := testCrawler(served, "Two")
+	c.LinkIndex, c.LinkIndexLast, c.FirstParagraphOnly = 2, true, true
+	pg, err := c.FollowLink(context.Background(), &Page{Title: "Start", Url: wikiURL("Start")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pg.Title != "One" {
+		t.Errorf("followed %s, want One", pg.Title)
+	}
+}
+
+// content returns the html of an article whose prose is paragraphs.
+func content(paragraphs string) string {
+	return `<div id="mw-content-text"><div class="mw-parser-output">` + paragraphs + `</div></div>`
+}
+
+// TestParseLinks checks the links parseLinks returns from
+// snippets of prose as configured by linkScan.
+func TestParseLinks(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		paragraphs string
+		scan       linkScan
+		want       []string
+		err        error
+	}{{
+		name:       "parentheses",
+		paragraphs: `<p>Foo (<a href="/wiki/Bad">Bad</a>) <a href="/wiki/Good">Good</a></p>`,
+		scan:       linkScan{limit: 1, firstParagraph: true},
+		want:       []string{"Good"},
+	}, {
+		name:       "first paragraph only",
+		paragraphs: `<p>Text alone.</p><p>Then <a href="/wiki/Later">Later</a></p>`,
+		scan:       linkScan{limit: 1, firstParagraph: true, onlyFirst: true},
+		err:        ErrNoLink,
+	}, {
+		name:       "first paragraph only of links",
+		paragraphs: `<p><a href="/wiki/One">One</a></p><p>Text <a href="/wiki/Two">Two</a></p>`,
+		scan:       linkScan{limit: 2, onlyFirst: true},
+		want:       []string{"One"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := parseLinks(strings.NewReader(content(tt.paragraphs)), fixtureURL, ContentID, fixtureAccept, tt.scan)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseLinks returned %v, want %v", err, tt.err)
+			}
+			if got := titles(links); !slices.Equal(got, tt.want) {
+				t.Errorf("links are %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFirstLinkEmptyParagraph checks that looking only at
+// the first paragraph, as with FirstParagraphOnly, a paragraph
+// holding only an image is not the first.
+func TestParseFirstLinkEmptyParagraph(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "empty-paragraph.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pg, err := parseFirstLink(f, fixtureURL, ContentID, fixtureAccept, linkScan{onlyFirst: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pg.Title != "Circle" {
+		t.Errorf("first link is %s, want Circle", pg.Url)
+	}
+}
+
+// TestLinks checks that Links returns every accepted link
+// within the content div in document order.
+func TestLinks(t *testing.T) {
+	served := articles{"Start": `<html><body><a href="/wiki/Outside">Outside</a>` + content(
+		`<table class="infobox"><tr><td><a href="/wiki/Infobox" title="Infobox">Infobox</a></td></tr></table>`+
+			`<p>First (<a href="/wiki/Aside" title="Aside">aside</a>) <a href="/wiki/File:Car.jpg">car</a> <a href="/wiki/Second" title="Second">second</a></p>`+
+			`<ul><li><a href="/wiki/Item" title="Item">item</a></li></ul>`+
+			`<p><a href="/wiki/Last" title="Last">last</a></p>`) + `</body></html>`}
+	page := &Page{Title: "Start", Url: wikiURL("Start")}
+	links, err := page.links(context.Background(), testCrawler(served, "Last"), fixtureAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := titles(links), []string{"Infobox", "Aside", "Second", "Item", "Last"}; !slices.Equal(got, want) {
+		t.Errorf("links are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,380 @@
+package wiki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// searchNode is a page found by Search,
+// linked to the page it was found on.
+type searchNode struct {
+	page   *Page
+	parent *searchNode
+	hops   int
+}
+
+// path returns the pages from the start of the search to n.
+func (n *searchNode) path() []*Page {
+	pages := make([]*Page, n.hops+1)
+	for ; n != nil; n = n.parent {
+		pages[n.hops] = n.page
+	}
+	return pages
+}
+
+// Search finds a shortest path of links from start to an article
+// whose URL is accepted by target, by breadth-first search over
+// every link of each article rather than only the first.
+// Links are followed as by Crawl, and no path longer than MaxHops
+// is explored if it is set.
+// It returns the pages of the path and why the search stopped,
+// along with an error if it was interrupted or failed. When no
+// path is found the path is that to the last article explored.
+func Search(ctx context.Context, start *url.URL, target, follow AcceptFunc) ([]*Page, StopReason, error) {
+	return (&Crawler{Target: target, Accept: follow}).Search(ctx, start)
+}
+
+// Search finds a shortest path of links from start to an article
+// accepted by c.Target, as the package's Search does. Visited
+// articles are remembered approximately if c.ApproxVisited is set.
+func (c *Crawler) Search(ctx context.Context, start *url.URL) ([]*Page, StopReason, error) {
+	if c.Target == nil {
+		return nil, Error, errors.New("cannot search without a target")
+	}
+	target, follow := c.Target, c.accept(start)
+	first := &searchNode{page: &Page{Title: strings.TrimPrefix(start.Path, "/wiki/"), Url: start}}
+	if err := checkExists(ctx, c, start, first.page.Title); err != nil {
+		if ctx.Err() != nil {
+			reason, err := stopped(ctx)
+			return first.path(), reason, err
+		}
+		return first.path(), Error, err
+	}
+	if target(start) {
+		return first.path(), Matched, nil
+	}
+
+	haveVisited := newVisitedSet(c.ApproxVisited)
+	haveVisited.add(VisitKey(start))
+	queue := []*searchNode{first}
+	limited := false
+	last := first
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		last = n
+		if max := c.maxHops(); max > 0 && n.hops >= max {
+			limited = true
+			continue
+		}
+
+		Logger.Info("search",
+			"hops", n.hops,
+			"title", n.page.Title,
+			"url", n.page.Url.String(),
+			"queued", len(queue))
+
+		links, err := n.page.links(ctx, c, All(func(ur *url.URL) bool {
+			return !haveVisited.has(VisitKey(ur))
+		}, follow))
+		if err != nil {
+			if ctx.Err() != nil {
+				reason, err := stopped(ctx)
+				return n.path(), reason, err
+			}
+			if !errors.Is(err, io.EOF) {
+				// Skip pages which cannot be fetched
+				// rather than abandoning the search
+				Logger.Warn("cannot search page", "url", n.page.Url.String(), "err", err)
+			}
+			continue
+		}
+		for _, link := range links {
+			key := VisitKey(link.Url)
+			if haveVisited.has(key) {
+				// Linked more than once from this page
+				continue
+			}
+			haveVisited.add(key)
+			child := &searchNode{page: link, parent: n, hops: n.hops + 1}
+			if target(link.Url) {
+				return child.path(), Matched, nil
+			}
+			queue = append(queue, child)
+		}
+	}
+	if limited {
+		return last.path(), LimitReached, nil
+	}
+	return last.path(), DeadEnd, nil
+}
+
+// ShortestPath finds a shortest path of links from start to the
+// article at target by breadth-first search from both ends at once,
+// following every link forward from start as Search does and
+// backward from target to the articles linking to it, as listed
+// by the Wikipedia API. Whichever end has the smaller frontier is
+// expanded a step at a time until the two searches meet.
+// Links are followed as by Crawl, and no path longer than MaxHops
+// is explored if it is set.
+// It returns the pages of the path and why the search stopped,
+// along with an error if it was interrupted or failed. When no
+// path is found the path is only the start.
+func ShortestPath(ctx context.Context, start, target *url.URL, follow AcceptFunc) ([]*Page, StopReason, error) {
+	return (&Crawler{Accept: follow}).ShortestPath(ctx, start, target)
+}
+
+// ShortestPath finds a shortest path of links from start to the
+// article at target as the package's ShortestPath does, fetching
+// articles as configured by c. c.Target is not used.
+func (c *Crawler) ShortestPath(ctx context.Context, start, target *url.URL) ([]*Page, StopReason, error) {
+	follow := c.accept(start)
+	first := &searchNode{page: &Page{Title: strings.TrimPrefix(start.Path, "/wiki/"), Url: start}}
+	last := &searchNode{page: &Page{Title: strings.TrimPrefix(target.Path, "/wiki/"), Url: target}}
+	for _, n := range []*searchNode{first, last} {
+		if err := checkExists(ctx, c, n.page.Url, n.page.Title); err != nil {
+			if ctx.Err() != nil {
+				reason, err := stopped(ctx)
+				return first.path(), reason, err
+			}
+			return first.path(), Error, err
+		}
+	}
+	if VisitKey(start) == VisitKey(target) {
+		return first.path(), Matched, nil
+	}
+
+	// Pages found from each end, the parents of those
+	// found backward lead to the target, not the start
+	forward := map[string]*searchNode{VisitKey(start): first}
+	backward := map[string]*searchNode{VisitKey(target): last}
+	fwdQueue, bwdQueue := []*searchNode{first}, []*searchNode{last}
+	for len(fwdQueue) > 0 && len(bwdQueue) > 0 {
+		if max := c.maxHops(); max > 0 && fwdQueue[0].hops+bwdQueue[0].hops >= max {
+			return first.path(), LimitReached, nil
+		}
+		var fwd, bwd *searchNode
+		var err error
+		if len(fwdQueue) <= len(bwdQueue) {
+			fwdQueue, fwd, bwd, err = expand(ctx, fwdQueue, forward, backward, func(ctx context.Context, page *Page) ([]*Page, error) {
+				return page.links(ctx, c, follow)
+			})
+		} else {
+			bwdQueue, bwd, fwd, err = expand(ctx, bwdQueue, backward, forward, func(ctx context.Context, page *Page) ([]*Page, error) {
+				return backlinks(ctx, c, page, follow)
+			})
+		}
+		if err != nil {
+			reason, err := stopped(ctx)
+			return first.path(), reason, err
+		}
+		if fwd != nil {
+			// Join the search from the start
+			// to the one from the target
+			pages := fwd.path()
+			for n := bwd.parent; n != nil; n = n.parent {
+				pages = append(pages, n.page)
+			}
+			return pages, Matched, nil
+		}
+	}
+	return first.path(), DeadEnd, nil
+}
+
+// Predecessors finds the articles which lead to the article at target
+// by following first links, by breadth-first search backward from it:
+// of the articles linking to each one found, as listed by the
+// Wikipedia API, those whose first link accepted by follow is to it
+// are found in turn. No chain longer than MaxHops is explored if it
+// is set. It returns a chain of pages from each article found which
+// none leads from to target, along with an error if the search was
+// interrupted or failed, in which case the chains are those so far.
+func Predecessors(ctx context.Context, target *url.URL, follow AcceptFunc) ([][]*Page, error) {
+	return (&Crawler{Accept: follow}).Predecessors(ctx, target)
+}
+
+// Predecessors finds the articles which lead to the article at target
+// by following first links as the package's Predecessors does, both
+// fetching articles and following their first links as configured
+// by c. c.Target is not used.
+func (c *Crawler) Predecessors(ctx context.Context, target *url.URL) ([][]*Page, error) {
+	follow := c.accept(target)
+	root := &searchNode{page: &Page{Title: strings.TrimPrefix(target.Path, "/wiki/"), Url: target}}
+	if err := checkExists(ctx, c, target, root.page.Title); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+		}
+		return nil, err
+	}
+
+	// Articles whose first link was checked, and
+	// the nodes of those leading to target
+	seen := map[string]bool{VisitKey(target): true}
+	var found []*searchNode
+	var err error
+	queue := []*searchNode{root}
+search:
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if max := c.maxHops(); max > 0 && n.hops >= max {
+			continue
+		}
+		Logger.Info("reverse search",
+			"hops", n.hops,
+			"title", n.page.Title,
+			"url", n.page.Url.String(),
+			"queued", len(queue))
+
+		var links []*Page
+		links, err = backlinks(ctx, c, n.page, func(ur *url.URL) bool {
+			return !seen[VisitKey(ur)] && follow(ur)
+		})
+		if err != nil {
+			break
+		}
+		for _, link := range links {
+			seen[VisitKey(link.Url)] = true
+			var next *Page
+			next, err = link.followLink(ctx, c, follow)
+			if ctx.Err() != nil {
+				break search
+			}
+			if err != nil {
+				// Skip articles which cannot be fetched
+				// or have no link rather than abandoning
+				// the search
+				if !errors.Is(err, ErrNoLink) {
+					Logger.Warn("cannot search page", "url", link.Url.String(), "err", err)
+				}
+				err = nil
+				continue
+			}
+			if key := VisitKey(next.Url); key != VisitKey(n.page.Url) && key != VisitKey(n.page.Canonical()) {
+				continue
+			}
+			child := &searchNode{page: link, parent: n, hops: n.hops + 1}
+			found = append(found, child)
+			queue = append(queue, child)
+		}
+	}
+	if ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+	}
+
+	// Chains begin at the articles nothing found leads from
+	leadsOn := make(map[*searchNode]bool)
+	for _, n := range found {
+		leadsOn[n.parent] = true
+	}
+	var chains [][]*Page
+	for _, n := range found {
+		if leadsOn[n] {
+			continue
+		}
+		var chain []*Page
+		for m := n; m != nil; m = m.parent {
+			chain = append(chain, m.page)
+		}
+		chains = append(chains, chain)
+	}
+	return chains, err
+}
+
+// expand searches each node of frontier with links, adding the
+// pages found to seen, and returns the nodes of the next frontier.
+// If a page found is already in other, the searches have met and
+// its node in seen and in other are returned instead.
+// The only error returned is that of the context being done.
+func expand(ctx context.Context, frontier []*searchNode, seen, other map[string]*searchNode, links func(context.Context, *Page) ([]*Page, error)) ([]*searchNode, *searchNode, *searchNode, error) {
+	var next []*searchNode
+	for _, n := range frontier {
+		Logger.Info("search",
+			"hops", n.hops,
+			"title", n.page.Title,
+			"url", n.page.Url.String(),
+			"queued", len(frontier)+len(next))
+
+		found, err := links(ctx, n.page)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, nil, fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+			}
+			if !errors.Is(err, io.EOF) {
+				Logger.Warn("cannot search page", "url", n.page.Url.String(), "err", err)
+			}
+			continue
+		}
+		for _, link := range found {
+			key := VisitKey(link.Url)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			child := &searchNode{page: link, parent: n, hops: n.hops + 1}
+			seen[key] = child
+			if m, ok := other[key]; ok {
+				return next, child, m, nil
+			}
+			next = append(next, child)
+		}
+	}
+	return next, nil, nil, nil
+}
+
+// backlinks returns the accepted articles linking to page, as
+// listed by the backlinks query of the Wikipedia API, asked by c.
+func backlinks(ctx context.Context, c *Crawler, page *Page, acceptFunc AcceptFunc) ([]*Page, error) {
+	api := &url.URL{Scheme: page.Url.Scheme, Host: page.Url.Host, Path: "/w/api.php"}
+	q := url.Values{
+		"action":        {"query"},
+		"list":          {"backlinks"},
+		"bltitle":       {strings.TrimPrefix(page.Url.Path, "/wiki/")},
+		"blnamespace":   {"0"},
+		"bllimit":       {"max"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+	}
+	var links []*Page
+	for {
+		api.RawQuery = q.Encode()
+		resp, err := get(ctx, c, api)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Continue map[string]string
+			Query    struct {
+				Backlinks []struct {
+					Title string
+				}
+			}
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("%s: unexpected status %s", api, resp.Status)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&res)
+		}
+		(&drainCloser{resp.Body}).Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, bl := range res.Query.Backlinks {
+			title := strings.ReplaceAll(bl.Title, " ", "_")
+			ur := page.Url.ResolveReference(&url.URL{Path: "/wiki/" + title})
+			if acceptFunc(ur) {
+				links = append(links, &Page{Title: title, Url: ur})
+			}
+		}
+		if res.Continue == nil {
+			return links, nil
+		}
+		for k, v := range res.Continue {
+			q.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package wiki
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/url"
+)
+
+// State is the progress of a crawl, from which it can be resumed.
+// It marshals to and from JSON.
+type State struct {
+	// Pages of the path so far, from the start
+	Path []*Page
+
+	// Pages visited by the crawl, including those
+	// backtracked from
+	Visited []*Page
+}
+
+// savedPage is the JSON representation of a Page within a State.
+type savedPage struct {
+	Title     string   `json:"title"`
+	Url       string   `json:"url"`
+	LinkText  string   `json:"link_text,omitempty"`
+	Redirects []string `json:"redirects,omitempty"`
+}
+
+// savedState is the JSON representation of a State.
+type savedState struct {
+	Path    []savedPage `json:"path"`
+	Visited []savedPage `json:"visited"`
+}
+
+func (s *State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(savedState{Path: savePages(s.Path), Visited: savePages(s.Visited)})
+}
+
+func (s *State) UnmarshalJSON(b []byte) error {
+	var saved savedState
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+	path, err := loadPages(saved.Path)
+	if err != nil {
+		return err
+	}
+	visited, err := loadPages(saved.Visited)
+	if err != nil {
+		return err
+	}
+	s.Path, s.Visited = path, visited
+	return nil
+}
+
+// savePages returns the JSON representations of pages.
+func savePages(pages []*Page) []savedPage {
+	saved := make([]savedPage, len(pages))
+	for i, page := range pages {
+		saved[i] = savedPage{Title: page.Title, Url: page.Url.String(), LinkText: page.LinkText, Redirects: formatURLs(page.Redirects)}
+	}
+	return saved
+}
+
+// loadPages returns the pages represented by saved.
+func loadPages(saved []savedPage) ([]*Page, error) {
+	pages := make([]*Page, len(saved))
+	for i, s := range saved {
+		ur, err := url.Parse(s.Url)
+		if err != nil {
+			return nil, err
+		}
+		redirects, err := parseURLs(s.Redirects)
+		if err != nil {
+			return nil, err
+		}
+		pages[i] = &Page{Title: s.Title, Url: ur, LinkText: s.LinkText, Redirects: redirects}
+	}
+	return pages, nil
+}
+
+// stateOf returns the state of a crawl with the path pageList
+// having visited the pages in haveVisited.
+func stateOf(pageList *list.List, haveVisited map[string]*Page) *State {
+	state := &State{Path: pathOf(pageList)}
+	for _, page := range haveVisited {
+		state.Visited = append(state.Visited, page)
+	}
+	return state
+}
@@ -0,0 +1,112 @@
+package wiki
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Trace makes every request time each phase of its connection and
+// response, logging them and adding them to those of TraceTotals.
+var Trace = false
+
+// Timings are the time taken by the phases of requests.
+type Timings struct {
+	// Requests timed
+	Requests int
+
+	// Looking up hosts, connecting to them and
+	// handshaking TLS, for new connections only
+	DNS, Connect, TLS time.Duration
+
+	// From each request starting until the first byte
+	// of its response, all of the above included
+	FirstByte time.Duration
+}
+
+// add adds the timings of o to t.
+func (t *Timings) add(o Timings) {
+	t.Requests += o.Requests
+	t.DNS += o.DNS
+	t.Connect += o.Connect
+	t.TLS += o.TLS
+	t.FirstByte += o.FirstByte
+}
+
+var (
+	totalsMu sync.Mutex
+	totals   Timings
+)
+
+// TraceTotals returns the timings of every request
+// made with Trace set so far, added up.
+func TraceTotals() Timings {
+	totalsMu.Lock()
+	defer totalsMu.Unlock()
+	return totals
+}
+
+// withTrace returns ctx timing the phases of a request on ur made with
+// it, and a function to call once its response has been received to
+// log the timings and add them to the totals.
+func withTrace(ctx context.Context, ur *url.URL) (context.Context, func()) {
+	var mu sync.Mutex
+	var t Timings
+	var dnsStart, connectStart, tlsStart time.Time
+	began := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			t.DNS += time.Since(dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			defer mu.Unlock()
+			connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			t.Connect += time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			t.TLS += time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			t.FirstByte = time.Since(began)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		mu.Lock()
+		t.Requests = 1
+		timed := t
+		mu.Unlock()
+		Logger.Info("request timings",
+			"url", ur.String(),
+			"dns", timed.DNS,
+			"connect", timed.Connect,
+			"tls", timed.TLS,
+			"first_byte", timed.FirstByte)
+		totalsMu.Lock()
+		defer totalsMu.Unlock()
+		totals.add(timed)
+	}
+}